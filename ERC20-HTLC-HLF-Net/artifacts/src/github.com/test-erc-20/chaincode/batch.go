@@ -0,0 +1,249 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the maximum number of items in a batch, to keep the transaction read-write set bounded
+const maxBatchSize = 100
+
+// Define HTLC batch event names
+const htlcLockedBatchEvent = "HTLCLockedBatch"
+const htlcClaimedBatchEvent = "HTLCClaimedBatch"
+const htlcRefundedBatchEvent = "HTLCRefundedBatch"
+
+// TransferConditionalRequest is an item of TransferConditionalBatch, with the arguments of TransferConditional
+type TransferConditionalRequest struct {
+	Recipient     string `json:"recipient"`
+	Amount        string `json:"amount"`
+	HashLock      string `json:"hashLock"`
+	TimeLock      string `json:"timeLock"`
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+}
+
+// ClaimRequest is an item of ClaimBatch, with the arguments of Claim
+type ClaimRequest struct {
+	HashLock string `json:"hashLock"`
+	Preimage string `json:"preimage"`
+}
+
+// RevertRequest is an item of RevertBatch, with the arguments of Revert
+type RevertRequest struct {
+	HashLock string `json:"hashLock"`
+}
+
+// htlcBatchEvent is the payload of the batch events, summarizing every HTLC of the batch
+type htlcBatchEvent struct {
+	Count       int     `json:"count"`
+	TotalAmount string  `json:"totalAmount"`
+	HTLCs       []*HTLC `json:"htlcs"`
+}
+
+// TransferConditionalBatch creates a conditional transfer from the client account for every item
+// Batches are a bulk settlement tool, only clients with the htlcOperator role can run them
+// The batch is atomic: if any item fails the transaction fails and no lock is created
+// It returns the created HTLCs in item order and triggers a single HTLCLockedBatch event
+func (s *SmartContract) TransferConditionalBatch(ctx contractapi.TransactionContextInterface, requests []TransferConditionalRequest) ([]*HTLC, error) {
+
+	// Check HTLC operator authorization, the tokens are locked from the operator's own balance
+	clientID, err := requireRole(ctx, htlcOperatorRole, "client is not authorized to run HTLC batches")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkBatchSize(len(requests))
+	if err != nil {
+		return nil, err
+	}
+
+	batchCtx := newBatchContext(ctx)
+	htlcs := make([]*HTLC, 0, len(requests))
+	for i, request := range requests {
+		htlc, err := transferConditionalHelper(batchCtx, clientID, request.Recipient, request.Amount, request.HashLock, request.TimeLock, request.HashAlgorithm, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock item %d: %v", i, err)
+		}
+		htlcs = append(htlcs, htlc)
+	}
+
+	err = emitHTLCBatchEvent(ctx, htlcLockedBatchEvent, htlcs)
+	if err != nil {
+		return nil, err
+	}
+
+	return htlcs, nil
+}
+
+// ClaimBatch claims every item with its preimage
+// The batch is atomic: if any item fails the transaction fails and no lock is claimed
+// It returns the claimed HTLCs in item order and triggers a single HTLCClaimedBatch event revealing the preimages
+func (s *SmartContract) ClaimBatch(ctx contractapi.TransactionContextInterface, requests []ClaimRequest) ([]*HTLC, error) {
+
+	// Check HTLC operator authorization, the tokens always go to the recipient of each lock
+	_, err := requireRole(ctx, htlcOperatorRole, "client is not authorized to run HTLC batches")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkBatchSize(len(requests))
+	if err != nil {
+		return nil, err
+	}
+
+	batchCtx := newBatchContext(ctx)
+	htlcs := make([]*HTLC, 0, len(requests))
+	for i, request := range requests {
+		htlc, err := claimHelper(batchCtx, request.HashLock, request.Preimage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim item %d: %v", i, err)
+		}
+		htlcs = append(htlcs, htlc)
+	}
+
+	err = emitHTLCBatchEvent(ctx, htlcClaimedBatchEvent, htlcs)
+	if err != nil {
+		return nil, err
+	}
+
+	return htlcs, nil
+}
+
+// RevertBatch reverts every item, returning the escrowed tokens to the client account
+// The batch is atomic: if any item fails the transaction fails and no lock is reverted
+// It returns the reverted HTLCs in item order and triggers a single HTLCRefundedBatch event
+func (s *SmartContract) RevertBatch(ctx contractapi.TransactionContextInterface, requests []RevertRequest) ([]*HTLC, error) {
+
+	// Check HTLC operator authorization, only locks created by the operator can be reverted
+	clientID, err := requireRole(ctx, htlcOperatorRole, "client is not authorized to run HTLC batches")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkBatchSize(len(requests))
+	if err != nil {
+		return nil, err
+	}
+
+	batchCtx := newBatchContext(ctx)
+	htlcs := make([]*HTLC, 0, len(requests))
+	for i, request := range requests {
+		htlc, err := revertHelper(batchCtx, clientID, request.HashLock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to revert item %d: %v", i, err)
+		}
+		htlcs = append(htlcs, htlc)
+	}
+
+	err = emitHTLCBatchEvent(ctx, htlcRefundedBatchEvent, htlcs)
+	if err != nil {
+		return nil, err
+	}
+
+	return htlcs, nil
+}
+
+// checkBatchSize validates the number of items of a batch
+func checkBatchSize(size int) error {
+
+	if size == 0 {
+		return fmt.Errorf("batch must contain at least one item")
+	}
+	if size > maxBatchSize {
+		return fmt.Errorf("batch contains %d items, the maximum is %d", size, maxBatchSize)
+	}
+
+	return nil
+}
+
+// emitHTLCBatchEvent emits the named batch event summarizing the HTLCs
+func emitHTLCBatchEvent(ctx contractapi.TransactionContextInterface, name string, htlcs []*HTLC) error {
+
+	batchEvent := htlcBatchEvent{Count: len(htlcs), HTLCs: make([]*HTLC, 0, len(htlcs))}
+	totalAmount := new(big.Int)
+	for _, htlc := range htlcs {
+		batchEvent.HTLCs = append(batchEvent.HTLCs, publicHTLC(htlc))
+		// Amounts of HTLCs with private terms are empty and not included in the total
+		totalAmount.Add(totalAmount, parseStoredAmount([]byte(htlc.Amount)))
+	}
+	batchEvent.TotalAmount = totalAmount.String()
+
+	batchEventJSON, err := json.Marshal(batchEvent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, batchEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// batchContext is a transaction context whose stub reads its own writes
+// The peer only returns committed state from GetState, so without it the second item of a batch
+// touching the same balance would overwrite the update of the first one
+type batchContext struct {
+	contractapi.TransactionContextInterface
+	stub *batchStub
+}
+
+func newBatchContext(ctx contractapi.TransactionContextInterface) *batchContext {
+	return &batchContext{
+		TransactionContextInterface: ctx,
+		stub: &batchStub{
+			ChaincodeStubInterface: ctx.GetStub(),
+			writes:                 make(map[string][]byte),
+			deletes:                make(map[string]bool),
+		},
+	}
+}
+
+// GetStub returns the stub that tracks the writes of the batch
+func (ctx *batchContext) GetStub() shim.ChaincodeStubInterface {
+	return ctx.stub
+}
+
+// batchStub records the writes of the transaction and serves them back to GetState
+type batchStub struct {
+	shim.ChaincodeStubInterface
+	writes  map[string][]byte
+	deletes map[string]bool
+}
+
+// GetState returns the value written earlier in the transaction, or the committed value
+func (stub *batchStub) GetState(key string) ([]byte, error) {
+	if stub.deletes[key] {
+		return nil, nil
+	}
+	if value, ok := stub.writes[key]; ok {
+		return value, nil
+	}
+	return stub.ChaincodeStubInterface.GetState(key)
+}
+
+// PutState writes the value and records it for later reads
+func (stub *batchStub) PutState(key string, value []byte) error {
+	err := stub.ChaincodeStubInterface.PutState(key, value)
+	if err != nil {
+		return err
+	}
+	stub.writes[key] = value
+	delete(stub.deletes, key)
+	return nil
+}
+
+// DelState deletes the key and records the deletion for later reads
+func (stub *batchStub) DelState(key string) error {
+	err := stub.ChaincodeStubInterface.DelState(key)
+	if err != nil {
+		return err
+	}
+	delete(stub.writes, key)
+	stub.deletes[key] = true
+	return nil
+}
@@ -0,0 +1,118 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestHTLCBatches(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	var htlcs []*chaincode.HTLC
+	err := submit(stub, func() error {
+		var err error
+		htlcs, err = contract.TransferConditionalBatch(bank, []chaincode.TransferConditionalRequest{
+			{Recipient: aliceID, Amount: "10", HashLock: hashLockOf("a"), TimeLock: "1h"},
+			{Recipient: aliceID, Amount: "20", HashLock: hashLockOf("b"), TimeLock: "1h", HashAlgorithm: "SHA256"},
+			{Recipient: aliceID, Amount: "30", HashLock: hashLockOf("c"), TimeLock: "1h"},
+		})
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, htlcs, 3)
+	require.Equal(t, "LOCKED", htlcs[2].State)
+
+	require.Equal(t, "HTLCLockedBatch", stub.Event.Name)
+	var lockedEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &lockedEvent))
+	require.EqualValues(t, 3, lockedEvent["count"])
+	require.Equal(t, "60", lockedEvent["totalAmount"])
+
+	bankBalance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "40", bankBalance.Available)
+	require.Equal(t, "60", bankBalance.Locked)
+
+	claims := []chaincode.ClaimRequest{
+		{HashLock: hashLockOf("a"), Preimage: "a"},
+		{HashLock: hashLockOf("b"), Preimage: "b"},
+	}
+	err = submit(stub, func() error { _, err := contract.ClaimBatch(alice, claims); return err })
+	require.EqualError(t, err, "client is not authorized to run HTLC batches")
+
+	// The operator settles on behalf of the recipient, the tokens always go to the recipient of each lock
+	err = submit(stub, func() error {
+		var err error
+		htlcs, err = contract.ClaimBatch(bank, claims)
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, htlcs, 2)
+
+	require.Equal(t, "HTLCClaimedBatch", stub.Event.Name)
+	var claimedEvent struct {
+		Count int `json:"count"`
+		HTLCs []struct {
+			Preimage string `json:"preimage"`
+		} `json:"htlcs"`
+	}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &claimedEvent))
+	require.Equal(t, 2, claimedEvent.Count)
+	require.Equal(t, "0x61", claimedEvent.HTLCs[0].Preimage)
+	require.Equal(t, "0x62", claimedEvent.HTLCs[1].Preimage)
+
+	aliceBalance, err := contract.BalanceOf(alice, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "30", aliceBalance.Available)
+
+	stub.TxTimestamp = timestamppb.New(stub.TxTimestamp.AsTime().Add(2 * time.Hour))
+
+	err = submit(stub, func() error {
+		var err error
+		htlcs, err = contract.RevertBatch(bank, []chaincode.RevertRequest{{HashLock: hashLockOf("c")}})
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "REFUNDED", htlcs[0].State)
+	require.Equal(t, "HTLCRefundedBatch", stub.Event.Name)
+
+	bankBalance, err = contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "70", bankBalance.Available)
+	require.Equal(t, "0", bankBalance.Locked)
+}
+
+func TestHTLCBatchRejectsInvalidItems(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	err := submit(stub, func() error { _, err := contract.ClaimBatch(bank, []chaincode.ClaimRequest{}); return err })
+	require.EqualError(t, err, "batch must contain at least one item")
+
+	err = submit(stub, func() error {
+		_, err := contract.TransferConditionalBatch(bank, []chaincode.TransferConditionalRequest{
+			{Recipient: aliceID, Amount: "10", HashLock: hashLockOf("a"), TimeLock: "1h"},
+			{Recipient: aliceID, Amount: "10", HashLock: hashLockOf("a"), TimeLock: "1h"},
+		})
+		return err
+	})
+	require.EqualError(t, err, "failed to lock item 1: HTLC already exists for hashLock: "+hashLockOf("a"))
+}
@@ -0,0 +1,283 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key name of the fee schedule, stored under the metadata object type
+const feeScheduleKey = "feeSchedule"
+
+// Define objectType name for the MSP ID of the organization of an account
+const accountMSPPrefix = "accountMSP"
+
+// Define the types of transfer fees
+const feeTypeNone = "NONE"
+const feeTypeFlat = "FLAT"
+const feeTypeBps = "BPS"
+
+// maxFeeBps is a fee of 100%
+const maxFeeBps = 10000
+
+// FeeSchedule is the fee charged on transfers between organizations: Transfer, TransferFrom, HTLC claims and executed holds
+// Value is the flat fee for the FLAT type and a number of basis points of the transferred amount for the BPS type
+// No fee is charged when the "from" or "to" account belongs to one of ExemptMSPs, or for transfers from or to the treasury
+type FeeSchedule struct {
+	Type          string   `json:"type"`
+	Value         string   `json:"value"`
+	Treasury      string   `json:"treasury"`
+	ExemptMSPs    []string `json:"exemptMSPs"`
+	SchemaVersion int      `json:"schemaVersion"`
+}
+
+// feeCharge is the fee charged on a transfer and the treasury account receiving it
+type feeCharge struct {
+	Amount   *big.Int
+	Treasury string
+}
+
+// feeEvent is the payload of the Fee event, which replaces the Transfer event when a fee is charged
+// Value is debited from the "from" account, the "to" account receives Value minus Fee and the treasury receives Fee
+type feeEvent struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`
+	Fee      string `json:"fee"`
+	Treasury string `json:"treasury"`
+}
+
+// SetFeeSchedule sets the fee charged on transfers between organizations: NONE, a FLAT amount or a number of basis points (BPS)
+// of the amount. Fees are paid to the treasury account, and not charged when either account belongs to one of the exempt MSPs
+// Only clients with the admin role can set the fee schedule. This function triggers a FeeScheduleChanged event
+func (s *SmartContract) SetFeeSchedule(ctx contractapi.TransactionContextInterface, feeType string, value string, treasury string, exemptMSPs []string) error {
+
+	// Check admin authorization
+	admin, err := requireRole(ctx, adminRole, "client is not authorized to change the fee schedule")
+	if err != nil {
+		return err
+	}
+
+	feeValue, err := parseAmount(value)
+	if err != nil {
+		return err
+	}
+	if feeValue.Sign() < 0 {
+		return fmt.Errorf("fee cannot be negative")
+	}
+
+	switch feeType {
+	case feeTypeNone:
+		feeValue = new(big.Int)
+	case feeTypeFlat:
+	case feeTypeBps:
+		if feeValue.Cmp(big.NewInt(maxFeeBps)) > 0 {
+			return fmt.Errorf("fee of %s basis points is above %d", feeValue, maxFeeBps)
+		}
+	default:
+		return fmt.Errorf("unknown fee type %s, expected NONE, FLAT or BPS", feeType)
+	}
+	if feeType != feeTypeNone && treasury == "" {
+		return fmt.Errorf("treasury must not be empty")
+	}
+	if exemptMSPs == nil {
+		exemptMSPs = []string{}
+	}
+
+	schedule := FeeSchedule{Type: feeType, Value: feeValue.String(), Treasury: treasury, ExemptMSPs: exemptMSPs, SchemaVersion: schemaVersion}
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = putNamespacedState(ctx, metadataPrefix, feeScheduleKey, scheduleJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update fee schedule: %v", err)
+	}
+
+	log.Printf("fee schedule set to %s %s paid to %s by %s", schedule.Type, schedule.Value, schedule.Treasury, admin)
+
+	err = ctx.GetStub().SetEvent("FeeScheduleChanged", scheduleJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// GetFeeSchedule returns the fee schedule, of type NONE until an admin sets one
+func (s *SmartContract) GetFeeSchedule(ctx contractapi.TransactionContextInterface) (*FeeSchedule, error) {
+
+	return feeScheduleHelper(ctx)
+}
+
+// feeHelper returns the fee charged on a transfer of value from the "from" account to the "to" account, nil when no fee is due
+// The fee depends on the organizations of the two accounts, never on the client submitting the transfer
+func feeHelper(ctx contractapi.TransactionContextInterface, from string, to string, value *big.Int) (*feeCharge, error) {
+
+	schedule, err := feeScheduleHelper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Type == feeTypeNone || value.Sign() == 0 || from == schedule.Treasury || to == schedule.Treasury {
+		return nil, nil
+	}
+
+	fromMSPID, err := accountMSPHelper(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	toMSPID, err := accountMSPHelper(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transfers within an organization are free, an account whose organization is not known counts as another organization
+	if fromMSPID != "" && fromMSPID == toMSPID {
+		return nil, nil
+	}
+	for _, exemptMSP := range schedule.ExemptMSPs {
+		if exemptMSP != "" && (fromMSPID == exemptMSP || toMSPID == exemptMSP) {
+			return nil, nil
+		}
+	}
+
+	feeValue := parseStoredAmount([]byte(schedule.Value))
+	fee := feeValue
+	if schedule.Type == feeTypeBps {
+		fee = new(big.Int).Mul(value, feeValue)
+		fee.Quo(fee, big.NewInt(maxFeeBps))
+	}
+	if fee.Sign() == 0 {
+		return nil, nil
+	}
+	if fee.Cmp(value) > 0 {
+		return nil, fmt.Errorf("transfer of %s does not cover the fee of %s", value, fee)
+	}
+
+	return &feeCharge{Amount: fee, Treasury: schedule.Treasury}, nil
+}
+
+// payFee credits the fee to the treasury account and records it in the treasury's history
+// Fees can not be paid to a frozen treasury
+func payFee(ctx contractapi.TransactionContextInterface, from string, charge *feeCharge) error {
+
+	err := checkNotFrozen(ctx, charge.Treasury)
+	if err != nil {
+		return err
+	}
+
+	treasuryBalanceBytes, err := getNamespacedState(ctx, balancePrefix, charge.Treasury)
+	if err != nil {
+		return fmt.Errorf("failed to read treasury account %s from world state: %v", charge.Treasury, err)
+	}
+
+	treasuryBalance, err := add(parseStoredAmount(treasuryBalanceBytes), charge.Amount)
+	if err != nil {
+		return err
+	}
+
+	err = putBalance(ctx, charge.Treasury, treasuryBalance)
+	if err != nil {
+		return err
+	}
+
+	return recordHistory(ctx, charge.Treasury, historyFee, from, charge.Amount, "")
+}
+
+// emitTransferEvent emits the Transfer event, or the Fee event when a fee was charged on the transfer
+func emitTransferEvent(ctx contractapi.TransactionContextInterface, from string, to string, value *big.Int, charge *feeCharge) error {
+
+	name := "Transfer"
+	var payload interface{} = event{from, to, value.String()}
+	if charge != nil {
+		name = "Fee"
+		payload = feeEvent{From: from, To: to, Value: value.String(), Fee: charge.Amount.String(), Treasury: charge.Treasury}
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// feeScheduleHelper reads the fee schedule from the world state
+func feeScheduleHelper(ctx contractapi.TransactionContextInterface) (*FeeSchedule, error) {
+
+	scheduleBytes, err := getNamespacedState(ctx, metadataPrefix, feeScheduleKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fee schedule from world state: %v", err)
+	}
+	if scheduleBytes == nil {
+		return &FeeSchedule{Type: feeTypeNone, Value: "0", ExemptMSPs: []string{}}, nil
+	}
+
+	var schedule FeeSchedule
+	err = json.Unmarshal(scheduleBytes, &schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fee schedule: %v", err)
+	}
+
+	return &schedule, nil
+}
+
+// accountMSPHelper returns the MSP ID of the organization of the account, empty when it is not known
+// The organization of the submitting client is always known, other accounts are known once they submitted a transaction
+func accountMSPHelper(ctx contractapi.TransactionContextInterface, account string) (string, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if account == clientID {
+		clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+		if err != nil {
+			return "", fmt.Errorf("failed to get MSPID: %v", err)
+		}
+		return clientMSPID, nil
+	}
+
+	mspIDBytes, err := getNamespacedState(ctx, accountMSPPrefix, account)
+	if err != nil {
+		return "", fmt.Errorf("failed to read organization of %s from world state: %v", account, err)
+	}
+
+	return decodeScalar(mspIDBytes), nil
+}
+
+// recordClientMSP stores the MSP ID of the submitting client as the organization of its account, the first time it submits
+// a transaction moving tokens. The peer validated the client certificate against that MSP, so the record can be trusted
+func recordClientMSP(ctx contractapi.TransactionContextInterface) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	mspIDBytes, err := getNamespacedState(ctx, accountMSPPrefix, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to read organization of %s from world state: %v", clientID, err)
+	}
+	if decodeScalar(mspIDBytes) == clientMSPID {
+		return nil
+	}
+
+	err = putNamespacedState(ctx, accountMSPPrefix, clientID, encodeScalar(clientMSPID))
+	if err != nil {
+		return fmt.Errorf("failed to put organization of %s to world state: %v", clientID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+const treasuryID = "x509::CN=treasury,OU=client::CN=ca.org1.example.com"
+const carolID = "x509::CN=carol,OU=client::CN=ca.org3.example.com"
+
+func TestTransferFees(t *testing.T) {
+	sc := mocks.NewScenario()
+	bank := sc.AdminIdentity(bankID, "Org1MSP")
+	alice := sc.Identity(aliceID, "Org2MSP")
+	mallory := sc.Identity(malloryID, "Org2MSP")
+	carol := sc.Identity(carolID, "Org3MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, sc.Submit(func() error { return contract.Mint(bank, "10000") }).Err)
+
+	schedule, err := contract.GetFeeSchedule(alice)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.FeeSchedule{Type: "NONE", Value: "0", ExemptMSPs: []string{}}, schedule)
+
+	result := sc.Submit(func() error { return contract.SetFeeSchedule(alice, "BPS", "100", treasuryID, nil) })
+	require.EqualError(t, result.Err, "client is not authorized to change the fee schedule")
+	result = sc.Submit(func() error { return contract.SetFeeSchedule(bank, "BPS", "10001", treasuryID, nil) })
+	require.EqualError(t, result.Err, "fee of 10001 basis points is above 10000")
+	result = sc.Submit(func() error { return contract.SetFeeSchedule(bank, "PERCENT", "1", treasuryID, nil) })
+	require.EqualError(t, result.Err, "unknown fee type PERCENT, expected NONE, FLAT or BPS")
+
+	// A 1% fee on transfers between organizations, not charged on transfers from or to Org1 accounts
+	result = sc.Submit(func() error { return contract.SetFeeSchedule(bank, "BPS", "100", treasuryID, []string{"Org1MSP"}) })
+	require.NoError(t, result.Err)
+	require.Equal(t, "FeeScheduleChanged", result.Event.Name)
+
+	result = sc.Submit(func() error { return contract.Transfer(bank, aliceID, "5000") })
+	require.NoError(t, result.Err)
+	require.Equal(t, "Transfer", result.Event.Name)
+
+	// Transfer, Carol's organization is not known until she submits a transaction
+	result = sc.Submit(func() error { return contract.Transfer(alice, carolID, "1000") })
+	require.NoError(t, result.Err)
+	require.Equal(t, "Fee", result.Event.Name)
+	var fee map[string]string
+	require.NoError(t, result.Event.Decode(&fee))
+	require.Equal(t, map[string]string{"from": aliceID, "to": carolID, "value": "1000", "fee": "10", "treasury": treasuryID}, fee)
+	require.Equal(t, mocks.StateChange{Before: "5000", After: "4000"}, result.Changes["balance~"+aliceID])
+	require.Equal(t, mocks.StateChange{After: "990"}, result.Changes["balance~"+carolID])
+	require.Equal(t, mocks.StateChange{After: "10"}, result.Changes["balance~"+treasuryID])
+	require.Equal(t, mocks.StateChange{After: "Org2MSP"}, result.Changes["accountMSP~"+aliceID])
+
+	// TransferFrom between organizations, the allowance is used for the full value
+	require.NoError(t, sc.Submit(func() error { return contract.Approve(carol, malloryID, "500") }).Err)
+	result = sc.Submit(func() error { return contract.TransferFrom(mallory, carolID, aliceID, "200") })
+	require.NoError(t, result.Err)
+	require.Equal(t, "Fee", result.Event.Name)
+	require.Equal(t, mocks.StateChange{Before: "500", After: "300"}, result.Changes["allowance~"+carolID+"~"+malloryID])
+	require.Equal(t, mocks.StateChange{Before: "4000", After: "4198"}, result.Changes["balance~"+aliceID])
+	require.Equal(t, mocks.StateChange{Before: "10", After: "12"}, result.Changes["balance~"+treasuryID])
+
+	// Transfers within an organization are free
+	result = sc.Submit(func() error { return contract.Transfer(alice, malloryID, "100") })
+	require.NoError(t, result.Err)
+	require.Equal(t, "Transfer", result.Event.Name)
+
+	// Claim, the fee depends on the parties and not on the client submitting the claim
+	require.NoError(t, sc.Submit(func() error { return contract.TransferConditional(carol, aliceID, "500", secretHashLock, "1h", "") }).Err)
+	result = sc.Submit(func() error { return contract.Claim(bank, secretHashLock, "secret") })
+	require.NoError(t, result.Err)
+	var claimed map[string]interface{}
+	require.Equal(t, "HTLCClaimed", result.Event.Name)
+	require.NoError(t, result.Event.Decode(&claimed))
+	require.Equal(t, "5", claimed["fee"])
+	require.Equal(t, treasuryID, claimed["treasury"])
+	require.Equal(t, mocks.StateChange{Before: "4098", After: "4593"}, result.Changes["balance~"+aliceID])
+	require.Equal(t, mocks.StateChange{Before: "12", After: "17"}, result.Changes["balance~"+treasuryID])
+
+	htlc, err := contract.GetHashTimeLock(alice, secretHashLock)
+	require.NoError(t, err)
+	require.Equal(t, "5", htlc.Fee)
+
+	// Fees can not be paid to a frozen treasury
+	require.NoError(t, sc.Submit(func() error { return contract.GrantRole(bank, "pauser", bankID) }).Err)
+	require.NoError(t, sc.Submit(func() error { return contract.FreezeAccount(bank, treasuryID) }).Err)
+	result = sc.Submit(func() error { return contract.Transfer(alice, carolID, "100") })
+	require.EqualError(t, result.Err, "failed to transfer: account "+treasuryID+" is frozen")
+	require.NoError(t, sc.Submit(func() error { return contract.UnfreezeAccount(bank, treasuryID) }).Err)
+
+	// A flat fee must be covered by the transferred amount
+	require.NoError(t, sc.Submit(func() error { return contract.SetFeeSchedule(bank, "FLAT", "5", treasuryID, nil) }).Err)
+	result = sc.Submit(func() error { return contract.Transfer(alice, carolID, "3") })
+	require.EqualError(t, result.Err, "failed to transfer: transfer of 3 does not cover the fee of 5")
+	result = sc.Submit(func() error { return contract.Transfer(bank, malloryID, "100") })
+	require.NoError(t, result.Err)
+	require.Equal(t, mocks.StateChange{Before: "100", After: "195"}, result.Changes["balance~"+malloryID])
+
+	page, err := contract.GetAccountHistory(alice, treasuryID, 0, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 4)
+	require.Equal(t, "FEE", page.Records[0].Type)
+	require.Equal(t, aliceID, page.Records[0].Counterparty)
+}
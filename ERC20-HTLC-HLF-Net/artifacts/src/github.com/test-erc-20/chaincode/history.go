@@ -0,0 +1,165 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType name for the account history index
+const txHistoryPrefix = "txhist"
+
+// Define the types of account history entries
+const historyMint = "MINT"
+const historyBurn = "BURN"
+const historyTransferIn = "TRANSFER_IN"
+const historyTransferOut = "TRANSFER_OUT"
+const historyHTLCLock = "HTLC_LOCK"
+const historyHTLCClaim = "HTLC_CLAIM"
+const historyHTLCRefund = "HTLC_REFUND"
+const historyFee = "FEE"
+const historyHold = "HOLD"
+const historyHoldExecute = "HOLD_EXECUTE"
+const historyHoldRelease = "HOLD_RELEASE"
+
+// HistoryEntry is a token movement of an account
+// Amounts leave the account for BURN, TRANSFER_OUT, HTLC_LOCK and HOLD entries, and enter it for the other types
+// HashLock is the hold ID for HOLD, HOLD_EXECUTE and HOLD_RELEASE entries
+// FEE entries are fees received by the treasury, TRANSFER_IN and HTLC_CLAIM amounts are net of fees
+// HTLC entries of HTLCs with private terms have no amount, as the history is on the public ledger
+type HistoryEntry struct {
+	Account       string    `json:"account"`
+	Type          string    `json:"type"`
+	Counterparty  string    `json:"counterparty"`
+	Amount        string    `json:"amount,omitempty"`
+	HashLock      string    `json:"hashLock,omitempty"`
+	TxID          string    `json:"txID"`
+	Timestamp     time.Time `json:"timestamp"`
+	SchemaVersion int       `json:"schemaVersion"`
+}
+
+// HistoryPage is a page of account history entries, oldest first
+// Pass the bookmark to the next call to fetch the following page, an empty bookmark means there are no more results
+type HistoryPage struct {
+	Records             []*HistoryEntry `json:"records"`
+	FetchedRecordsCount int32           `json:"fetchedRecordsCount"`
+	Bookmark            string          `json:"bookmark"`
+}
+
+// BalanceRecord is a committed value of an account balance
+type BalanceRecord struct {
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	Balance   string    `json:"balance"`
+	IsDelete  bool      `json:"isDelete"`
+}
+
+// GetAccountHistory returns a page of the token movements of the account, oldest first
+func (s *SmartContract) GetAccountHistory(ctx contractapi.TransactionContextInterface, account string, pageSize int32, bookmark string) (*HistoryPage, error) {
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(txHistoryPrefix, []string{account}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history of %s: %v", account, err)
+	}
+	defer resultsIterator.Close()
+
+	page := &HistoryPage{Records: []*HistoryEntry{}, FetchedRecordsCount: responseMetadata.GetFetchedRecordsCount(), Bookmark: responseMetadata.GetBookmark()}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of %s: %v", account, err)
+		}
+
+		var entry HistoryEntry
+		err = json.Unmarshal(queryResponse.Value, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal history entry: %v", err)
+		}
+		page.Records = append(page.Records, &entry)
+	}
+
+	return page, nil
+}
+
+// GetBalanceHistory returns every committed value of the account balance, from the ledger history of its balance key
+// It requires the history database of the peer, which is enabled by default
+func (s *SmartContract) GetBalanceHistory(ctx contractapi.TransactionContextInterface, account string) ([]*BalanceRecord, error) {
+
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(balancePrefix, []string{account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", balancePrefix, err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(balanceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balance history of %s: %v", account, err)
+	}
+	defer resultsIterator.Close()
+
+	records := []*BalanceRecord{}
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read balance history of %s: %v", account, err)
+		}
+
+		records = append(records, &BalanceRecord{
+			TxID:      modification.GetTxId(),
+			Timestamp: modification.GetTimestamp().AsTime().UTC(),
+			Balance:   parseStoredAmount(modification.GetValue()).String(),
+			IsDelete:  modification.GetIsDelete(),
+		})
+	}
+
+	return records, nil
+}
+
+// recordHistory appends a token movement to the history index of the account
+// Entries are keyed by account, transaction timestamp, transaction ID, type and hashLock or counterparty,
+// so that every movement of a transaction gets its own key and entries sort in time order. A nil amount is left out
+func recordHistory(ctx contractapi.TransactionContextInterface, account string, entryType string, counterparty string, amount *big.Int, hashLock string) error {
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	discriminator := counterparty
+	if hashLock != "" {
+		discriminator = hashLock
+	}
+
+	entry := HistoryEntry{
+		Account:       account,
+		Type:          entryType,
+		Counterparty:  counterparty,
+		HashLock:      hashLock,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     now,
+		SchemaVersion: schemaVersion,
+	}
+
+	if amount != nil {
+		entry.Amount = amount.String()
+	}
+
+	historyKey, err := ctx.GetStub().CreateCompositeKey(txHistoryPrefix, []string{account, fmt.Sprintf("%020d", now.UnixNano()), entry.TxID, entryType, discriminator})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", txHistoryPrefix, err)
+	}
+
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(historyKey, entryJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put history entry in the world state: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestAccountHistory(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	nextTx(stub)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+	nextTx(stub)
+	require.NoError(t, submit(stub, func() error { return contract.Transfer(bank, aliceID, "40") }))
+	nextTx(stub)
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "10", secretHashLock, "1h", "") }))
+	nextTx(stub)
+	require.NoError(t, submit(stub, func() error { return contract.Claim(alice, secretHashLock, "secret") }))
+	nextTx(stub)
+	require.NoError(t, submit(stub, func() error { return contract.Burn(bank, "5") }))
+
+	page, err := contract.GetAccountHistory(bank, bankID, 3, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 3)
+	require.Equal(t, "MINT", page.Records[0].Type)
+	require.Equal(t, "100", page.Records[0].Amount)
+	require.Equal(t, "TRANSFER_OUT", page.Records[1].Type)
+	require.Equal(t, aliceID, page.Records[1].Counterparty)
+	require.Equal(t, "HTLC_LOCK", page.Records[2].Type)
+	require.Equal(t, secretHashLock, page.Records[2].HashLock)
+	require.NotEmpty(t, page.Bookmark)
+
+	page, err = contract.GetAccountHistory(bank, bankID, 3, page.Bookmark)
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, "BURN", page.Records[0].Type)
+
+	page, err = contract.GetAccountHistory(alice, aliceID, 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 2)
+	require.Equal(t, "TRANSFER_IN", page.Records[0].Type)
+	require.Equal(t, "HTLC_CLAIM", page.Records[1].Type)
+	require.Equal(t, bankID, page.Records[1].Counterparty)
+
+	// The balance history comes from the ledger history, newest first
+	records, err := contract.GetBalanceHistory(alice, aliceID)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "50", records[0].Balance)
+	require.Equal(t, "40", records[1].Balance)
+	require.Equal(t, stub.TxTimestamp.AsTime().Add(-time.Second), records[0].Timestamp)
+}
+
+func TestAccountHistoryOfBatch(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+	stub.TxTimestamp = timestamppb.New(stub.TxTimestamp.AsTime().Add(time.Second))
+	stub.TxID = "batch"
+
+	// Every lock of a batch gets its own history entry
+	err := submit(stub, func() error {
+		_, err := contract.TransferConditionalBatch(bank, []chaincode.TransferConditionalRequest{
+			{Recipient: aliceID, Amount: "10", HashLock: hashLockOf("a"), TimeLock: "1h"},
+			{Recipient: aliceID, Amount: "20", HashLock: hashLockOf("b"), TimeLock: "1h"},
+		})
+		return err
+	})
+	require.NoError(t, err)
+
+	page, err := contract.GetAccountHistory(bank, bankID, 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 3)
+	require.Equal(t, "batch", page.Records[1].TxID)
+	require.Equal(t, "batch", page.Records[2].TxID)
+}
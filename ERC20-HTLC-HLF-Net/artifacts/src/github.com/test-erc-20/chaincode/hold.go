@@ -0,0 +1,343 @@
+package chaincode
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType name for the amount of the locked balance that is on hold
+const holdBalancePrefix = "holdBalance"
+
+// Define the final states of a hold, a hold moves from LOCKED to either EXECUTED or RELEASED
+const holdStateExecuted = "EXECUTED"
+const holdStateReleased = "RELEASED"
+
+// Define hold event names
+const holdCreatedEvent = "HoldCreated"
+const holdExecutedEvent = "HoldExecuted"
+const holdReleasedEvent = "HoldReleased"
+
+// A hold reserves tokens of the payer for a payee, like a HTLC without a hash lock: instead of a preimage, a notary
+// decides whether the tokens are paid to the payee or released back to the payer, in the style of ERC-1996
+// Holds are stored as HTLC records under their hold ID, the ID of the transaction creating them, with the notary set.
+// Their tokens are held in the same escrow accounts and counted in the locked balance, so Claim and Revert reject them
+
+// Hold reserves amount tokens of the "from" account for the "to" account until the notary executes or releases the hold
+// The caller is either the "from" account, or an operator spending its allowance from the "from" account like TransferFrom
+// expiry is either an RFC3339 timestamp or a duration such as "24h" counted from the transaction timestamp
+// This function returns the hold ID and triggers a HoldCreated event
+func (s *SmartContract) Hold(ctx contractapi.TransactionContextInterface, from string, to string, amount string, notary string, expiry string) (string, error) {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	holdAmount, err := parseAmount(amount)
+	if err != nil {
+		return "", err
+	}
+
+	if to == "" || notary == "" {
+		return "", fmt.Errorf("recipient and notary must not be empty")
+	}
+	if from == to {
+		return "", fmt.Errorf("cannot hold tokens to and from same client account")
+	}
+
+	err = checkTransferable(ctx, clientID, from, to)
+	if err != nil {
+		return "", err
+	}
+
+	err = recordClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// An operator holds tokens on behalf of the payer with its allowance, which the hold consumes
+	var currentAllowance *big.Int
+	if clientID != from {
+		var found bool
+		currentAllowance, found, err = allowanceHelper(ctx, from, clientID)
+		if err != nil {
+			return "", err
+		}
+		if !found || currentAllowance.Cmp(holdAmount) < 0 {
+			return "", fmt.Errorf("client is not authorized to hold %s tokens of %s", holdAmount, from)
+		}
+	}
+
+	holdID := ctx.GetStub().GetTxID()
+	existingBytes, err := getNamespacedState(ctx, htlcPrefix, holdID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read HTLC details from the world state: %v", err)
+	}
+	if existingBytes != nil {
+		return "", fmt.Errorf("hold %s already exists", holdID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	expiryTime, err := parseTimeLock(expiry, now)
+	if err != nil {
+		return "", err
+	}
+
+	err = lockInEscrow(ctx, from, holdID, holdAmount, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to lock tokens in escrow: %v", err)
+	}
+
+	err = addHoldBalance(ctx, from, holdAmount)
+	if err != nil {
+		return "", err
+	}
+
+	if currentAllowance != nil {
+		err = putAllowance(ctx, from, clientID, new(big.Int).Sub(currentAllowance, holdAmount))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	hold := &HTLC{
+		Sender:    from,
+		Recipient: to,
+		Amount:    holdAmount.String(),
+		HashLock:  holdID,
+		TimeLock:  expiryTime,
+		State:     htlcStateLocked,
+		Notary:    notary,
+	}
+
+	err = putHTLC(ctx, hold)
+	if err != nil {
+		return "", err
+	}
+
+	err = recordHistory(ctx, from, historyHold, to, holdAmount, holdID)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("client %s put %s tokens of %s on hold for %s with notary %s", clientID, holdAmount, from, to, notary)
+
+	err = emitHTLCEvent(ctx, holdCreatedEvent, hold)
+	if err != nil {
+		return "", err
+	}
+
+	return holdID, nil
+}
+
+// ExecuteHold pays the tokens on hold to the payee, less the transfer fee if any
+// Only the notary of the hold can execute it, before its expiry. This function triggers a HoldExecuted event
+func (s *SmartContract) ExecuteHold(ctx contractapi.TransactionContextInterface, holdID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	hold, err := holdHelper(ctx, holdID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != hold.Notary {
+		return fmt.Errorf("client is not authorized to execute hold %s: only its notary can execute it", holdID)
+	}
+	if hold.State != htlcStateLocked {
+		return fmt.Errorf("invalid execution: hold is %s", hold.State)
+	}
+
+	// The tokens on hold can not be paid to a frozen payee
+	err = checkTransferable(ctx, hold.Recipient)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.Before(hold.TimeLock) {
+		return fmt.Errorf("invalid execution: hold expired at %s", hold.TimeLock.Format("2006-01-02 15:04:05"))
+	}
+
+	// A fee due on the execution is deducted from the tokens paid to the payee
+	amount := parseStoredAmount([]byte(hold.Amount))
+	charge, err := feeHelper(ctx, hold.Sender, hold.Recipient, amount)
+	if err != nil {
+		return fmt.Errorf("invalid execution: %v", err)
+	}
+	if charge != nil {
+		hold.Fee = charge.Amount.String()
+		hold.Treasury = charge.Treasury
+		amount = new(big.Int).Sub(amount, charge.Amount)
+	}
+
+	err = finishHold(ctx, hold, hold.Recipient, holdStateExecuted, charge)
+	if err != nil {
+		return err
+	}
+
+	err = recordHistory(ctx, hold.Recipient, historyHoldExecute, hold.Sender, amount, hold.HashLock)
+	if err != nil {
+		return err
+	}
+
+	return emitHTLCEvent(ctx, holdExecutedEvent, hold)
+}
+
+// ReleaseHold returns the tokens on hold to the payer
+// The notary and the payee can release a hold at any time, the payer only once it has expired
+// This function triggers a HoldReleased event
+func (s *SmartContract) ReleaseHold(ctx contractapi.TransactionContextInterface, holdID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	hold, err := holdHelper(ctx, holdID)
+	if err != nil {
+		return err
+	}
+
+	if hold.State != htlcStateLocked {
+		return fmt.Errorf("invalid release: hold is %s", hold.State)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch clientID {
+	case hold.Notary, hold.Recipient:
+	case hold.Sender:
+		if now.Before(hold.TimeLock) {
+			return fmt.Errorf("invalid release: hold not yet expired")
+		}
+	default:
+		return fmt.Errorf("client is not authorized to release hold %s", holdID)
+	}
+
+	err = checkTransferable(ctx, hold.Sender)
+	if err != nil {
+		return err
+	}
+
+	err = finishHold(ctx, hold, hold.Sender, holdStateReleased, nil)
+	if err != nil {
+		return err
+	}
+
+	err = recordHistory(ctx, hold.Sender, historyHoldRelease, hold.Recipient, parseStoredAmount([]byte(hold.Amount)), hold.HashLock)
+	if err != nil {
+		return err
+	}
+
+	return emitHTLCEvent(ctx, holdReleasedEvent, hold)
+}
+
+// GetHold returns the hold with the given ID
+func (s *SmartContract) GetHold(ctx contractapi.TransactionContextInterface, holdID string) (*HTLC, error) {
+
+	return holdHelper(ctx, holdID)
+}
+
+// BalanceOnHold returns the amount of the locked balance of the account that is on hold
+func (s *SmartContract) BalanceOnHold(ctx contractapi.TransactionContextInterface, account string) (string, error) {
+
+	onHold, err := holdBalanceHelper(ctx, account)
+	if err != nil {
+		return "", err
+	}
+
+	return onHold.String(), nil
+}
+
+// holdHelper reads the hold with the given ID from the world state
+func holdHelper(ctx contractapi.TransactionContextInterface, holdID string) (*HTLC, error) {
+
+	holdBytes, err := getNamespacedState(ctx, htlcPrefix, holdID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTLC details from the world state: %v", err)
+	}
+	if holdBytes == nil {
+		return nil, fmt.Errorf("hold not found for ID: %s", holdID)
+	}
+
+	hold, err := unmarshalHTLC(holdBytes)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Notary == "" {
+		return nil, fmt.Errorf("%s is a HTLC, not a hold", holdID)
+	}
+
+	return hold, nil
+}
+
+// finishHold releases the escrowed tokens of the hold to the "to" account and stores its final state
+func finishHold(ctx contractapi.TransactionContextInterface, hold *HTLC, to string, state string, charge *feeCharge) error {
+
+	err := releaseEscrow(ctx, hold, to, charge)
+	if err != nil {
+		return err
+	}
+
+	err = addHoldBalance(ctx, hold.Sender, new(big.Int).Neg(parseStoredAmount([]byte(hold.Amount))))
+	if err != nil {
+		return err
+	}
+
+	hold.State = state
+
+	return putHTLC(ctx, hold)
+}
+
+// holdBalanceHelper returns the total amount an account has on hold
+func holdBalanceHelper(ctx contractapi.TransactionContextInterface, account string) (*big.Int, error) {
+
+	onHoldBytes, err := getNamespacedState(ctx, holdBalancePrefix, account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balance on hold of %s from world state: %v", account, err)
+	}
+
+	return parseStoredAmount(onHoldBytes), nil
+}
+
+// addHoldBalance adds value, which is negative when a hold ends, to the total amount the account has on hold
+func addHoldBalance(ctx contractapi.TransactionContextInterface, account string, value *big.Int) error {
+
+	current, err := holdBalanceHelper(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	updated := new(big.Int).Add(current, value)
+	if updated.Sign() < 0 {
+		return fmt.Errorf("balance on hold of %s can not be negative", account)
+	}
+
+	err = checkpointSnapshot(ctx, holdBalancePrefix, account)
+	if err != nil {
+		return err
+	}
+
+	if updated.Sign() == 0 {
+		return delNamespacedState(ctx, holdBalancePrefix, account)
+	}
+
+	return putNamespacedState(ctx, holdBalancePrefix, account, encodeScalar(updated.String()))
+}
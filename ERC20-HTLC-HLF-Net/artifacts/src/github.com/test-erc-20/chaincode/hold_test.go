@@ -0,0 +1,100 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+func TestHolds(t *testing.T) {
+	sc := mocks.NewScenario()
+	bank := sc.AdminIdentity(bankID, "Org1MSP")
+	notary := sc.Identity(bondxID, "Org1MSP")
+	alice := sc.Identity(aliceID, "Org2MSP")
+	mallory := sc.Identity(malloryID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, sc.Submit(func() error { return contract.Mint(bank, "1000") }).Err)
+
+	var holdID string
+	hold := func(ctx *mocks.TransactionContext, from string, amount string) *mocks.TxResult {
+		return sc.Submit(func() error {
+			var err error
+			holdID, err = contract.Hold(ctx, from, aliceID, amount, bondxID, "1h")
+			return err
+		})
+	}
+
+	// Hold, reusing the escrow accounting of HTLCs
+	result := hold(bank, bankID, "300")
+	require.NoError(t, result.Err)
+	require.Equal(t, result.TxID, holdID)
+	require.Equal(t, "HoldCreated", result.Event.Name)
+	var payload map[string]interface{}
+	require.NoError(t, result.Event.Decode(&payload))
+	require.Equal(t, bondxID, payload["notary"])
+	require.Equal(t, "LOCKED", payload["state"])
+	require.Equal(t, mocks.StateChange{After: "300"}, result.Changes["htlcEscrow~"+holdID])
+
+	balance, err := contract.BalanceOf(alice, bankID)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.AccountBalance{Account: bankID, Available: "700", Locked: "300", OnHold: "300"}, balance)
+
+	// A hold is not a HTLC
+	result = sc.Submit(func() error { return contract.Revert(bank, holdID) })
+	require.Error(t, result.Err)
+	_, err = contract.GetHold(alice, hashLockOf("secret"))
+	require.EqualError(t, err, "hold not found for ID: "+hashLockOf("secret"))
+
+	// Only the notary executes
+	result = sc.Submit(func() error { return contract.ExecuteHold(alice, holdID) })
+	require.EqualError(t, result.Err, "client is not authorized to execute hold "+holdID+": only its notary can execute it")
+	result = sc.Submit(func() error { return contract.ExecuteHold(notary, holdID) })
+	require.NoError(t, result.Err)
+	require.Equal(t, "HoldExecuted", result.Event.Name)
+	require.Equal(t, mocks.StateChange{After: "300"}, result.Changes["balance~"+aliceID])
+	require.Equal(t, mocks.StateChange{Before: "300", Deleted: true}, result.Changes["holdBalance~"+bankID])
+
+	executed, err := contract.GetHold(alice, holdID)
+	require.NoError(t, err)
+	require.Equal(t, "EXECUTED", executed.State)
+	result = sc.Submit(func() error { return contract.ReleaseHold(notary, holdID) })
+	require.EqualError(t, result.Err, "invalid release: hold is EXECUTED")
+
+	// An operator holds with its allowance
+	require.NoError(t, sc.Submit(func() error { return contract.Approve(bank, malloryID, "250") }).Err)
+	result = hold(mallory, bankID, "251")
+	require.EqualError(t, result.Err, "client is not authorized to hold 251 tokens of "+bankID)
+	result = hold(mallory, bankID, "200")
+	require.NoError(t, result.Err)
+	require.Equal(t, mocks.StateChange{Before: "250", After: "50"}, result.Changes["allowance~"+bankID+"~"+malloryID])
+
+	// The payer releases only after expiry, the payee and the notary at any time
+	result = sc.Submit(func() error { return contract.ReleaseHold(bank, holdID) })
+	require.EqualError(t, result.Err, "invalid release: hold not yet expired")
+	result = sc.Submit(func() error { return contract.ReleaseHold(mallory, holdID) })
+	require.EqualError(t, result.Err, "client is not authorized to release hold "+holdID)
+	result = sc.Submit(func() error { return contract.ReleaseHold(alice, holdID) })
+	require.NoError(t, result.Err)
+	require.Equal(t, "HoldReleased", result.Event.Name)
+	require.Equal(t, mocks.StateChange{Before: "500", After: "700"}, result.Changes["balance~"+bankID])
+
+	// An expired hold can no longer be executed
+	require.NoError(t, hold(bank, bankID, "100").Err)
+	sc.Advance(time.Hour)
+	result = sc.Submit(func() error { return contract.ExecuteHold(notary, holdID) })
+	require.ErrorContains(t, result.Err, "invalid execution: hold expired")
+	require.NoError(t, sc.Submit(func() error { return contract.ReleaseHold(bank, holdID) }).Err)
+
+	balance, err = contract.BalanceOf(alice, bankID)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.AccountBalance{Account: bankID, Available: "700", Locked: "0", OnHold: "0"}, balance)
+
+	page, err := contract.ListHTLCsByState(alice, "RELEASED", 0, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 2)
+}
@@ -0,0 +1,289 @@
+package chaincode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for the HTLC index keys
+const htlcBySenderPrefix = "htlcBySender"
+const htlcByRecipientPrefix = "htlcByRecipient"
+const htlcByStatePrefix = "htlcByState"
+const htlcByExpiryPrefix = "htlcByExpiry"
+const htlcByLockIDPrefix = "htlcByLockID"
+
+// Index keys only need to exist, the HTLC itself is read from its htlc key
+var indexValue = []byte{0x00}
+
+// HTLCPage is a page of HTLCs returned by the paginated list queries
+// Pass the bookmark to the next call to fetch the following page, an empty bookmark means there are no more results
+type HTLCPage struct {
+	Records             []*HTLC `json:"records"`
+	FetchedRecordsCount int32   `json:"fetchedRecordsCount"`
+	Bookmark            string  `json:"bookmark"`
+}
+
+// ListHTLCsBySender returns a page of the HTLCs created by the sender
+func (s *SmartContract) ListHTLCsBySender(ctx contractapi.TransactionContextInterface, sender string, pageSize int32, bookmark string) (*HTLCPage, error) {
+
+	return listHTLCsByIndex(ctx, htlcBySenderPrefix, []string{sender}, pageSize, bookmark)
+}
+
+// ListHTLCsByRecipient returns a page of the HTLCs that pay out to the recipient
+func (s *SmartContract) ListHTLCsByRecipient(ctx contractapi.TransactionContextInterface, recipient string, pageSize int32, bookmark string) (*HTLCPage, error) {
+
+	return listHTLCsByIndex(ctx, htlcByRecipientPrefix, []string{recipient}, pageSize, bookmark)
+}
+
+// ListHTLCsByState returns a page of the HTLCs in the given state: LOCKED, CLAIMED or REFUNDED
+// Holds are listed as LOCKED, EXECUTED or RELEASED
+func (s *SmartContract) ListHTLCsByState(ctx contractapi.TransactionContextInterface, state string, pageSize int32, bookmark string) (*HTLCPage, error) {
+
+	switch state {
+	case htlcStateLocked, htlcStateClaimed, htlcStateRefunded, holdStateExecuted, holdStateReleased:
+	default:
+		return nil, fmt.Errorf("unknown HTLC state %s, expected %s, %s, %s, %s or %s", state, htlcStateLocked, htlcStateClaimed, htlcStateRefunded, holdStateExecuted, holdStateReleased)
+	}
+
+	return listHTLCsByIndex(ctx, htlcByStatePrefix, []string{state}, pageSize, bookmark)
+}
+
+// ListExpiringHTLCs returns a page of the locked HTLCs whose timelock expires before the given time, soonest first
+// before is either an RFC3339 timestamp or a duration such as "1h" counted from the transaction timestamp
+// Expired locks that have not been reverted yet are included
+func (s *SmartContract) ListExpiringHTLCs(ctx contractapi.TransactionContextInterface, before string, pageSize int32, bookmark string) (*HTLCPage, error) {
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	beforeTime, err := parseQueryTime(before, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// The expiry index only holds locked HTLCs, ordered by timelock, so the scan stops at the first later timelock
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(htlcByExpiryPrefix, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s index: %v", htlcByExpiryPrefix, err)
+	}
+	defer resultsIterator.Close()
+
+	page := &HTLCPage{Records: []*HTLC{}, Bookmark: responseMetadata.GetBookmark()}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s index: %v", htlcByExpiryPrefix, err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split the composite key %s: %v", queryResponse.Key, err)
+		}
+
+		if attributes[0] >= expiryIndexTime(beforeTime) {
+			page.Bookmark = ""
+			break
+		}
+
+		htlc, err := htlcHelper(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		page.Records = append(page.Records, htlc)
+	}
+	page.FetchedRecordsCount = int32(len(page.Records))
+
+	return page, nil
+}
+
+// QueryHTLCs returns a page of the HTLCs matching a CouchDB rich query selector, for example
+// {"selector":{"state":"LOCKED","sender":"x509::..."},"sort":[{"timeLock":"asc"}]}
+// Only available when the peers use CouchDB as state database, the indexes are shipped under META-INF/statedb/couchdb/indexes
+func (s *SmartContract) QueryHTLCs(ctx contractapi.TransactionContextInterface, queryString string, pageSize int32, bookmark string) (*HTLCPage, error) {
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run rich query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	page := &HTLCPage{Records: []*HTLC{}, Bookmark: responseMetadata.GetBookmark()}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rich query results: %v", err)
+		}
+
+		// Only documents stored under the htlc namespace are HTLCs
+		objectType, _, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil || objectType != htlcPrefix {
+			continue
+		}
+
+		htlc, err := unmarshalHTLC(queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		page.Records = append(page.Records, htlc)
+	}
+	// CouchDB counts the documents of other objectTypes matching the selector, they are not returned
+	page.FetchedRecordsCount = int32(len(page.Records))
+
+	return page, nil
+}
+
+// listHTLCsByIndex returns a page of the HTLCs referenced by an index, the hashLock is the last attribute of each index key
+func listHTLCsByIndex(ctx contractapi.TransactionContextInterface, indexPrefix string, attributes []string, pageSize int32, bookmark string) (*HTLCPage, error) {
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(indexPrefix, attributes, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s index: %v", indexPrefix, err)
+	}
+	defer resultsIterator.Close()
+
+	records, err := readIndexedHTLCs(ctx, indexPrefix, resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTLCPage{Records: records, FetchedRecordsCount: responseMetadata.GetFetchedRecordsCount(), Bookmark: responseMetadata.GetBookmark()}, nil
+}
+
+// readIndexedHTLCs reads the HTLC of every index key returned by the iterator
+func readIndexedHTLCs(ctx contractapi.TransactionContextInterface, indexPrefix string, resultsIterator shim.StateQueryIteratorInterface) ([]*HTLC, error) {
+
+	records := []*HTLC{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s index: %v", indexPrefix, err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split the composite key %s: %v", queryResponse.Key, err)
+		}
+
+		htlcBytes, err := getNamespacedState(ctx, htlcPrefix, attributes[len(attributes)-1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HTLC details from the world state: %v", err)
+		}
+		if htlcBytes == nil {
+			return nil, fmt.Errorf("HTLC not found for index key %s", queryResponse.Key)
+		}
+
+		htlc, err := unmarshalHTLC(htlcBytes)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, htlc)
+	}
+
+	return records, nil
+}
+
+// putHTLCIndexes keeps the index keys of the HTLC in line with its current state
+// Sender and recipient never change, the state index moves with the state and only locked HTLCs are in the expiry index
+func putHTLCIndexes(ctx contractapi.TransactionContextInterface, htlc *HTLC) error {
+
+	indexes := map[string][]string{
+		htlcBySenderPrefix: {htlc.Sender, htlc.HashLock},
+	}
+	// HTLCs with private terms have no public recipient to index
+	if htlc.Recipient != "" {
+		indexes[htlcByRecipientPrefix] = []string{htlc.Recipient, htlc.HashLock}
+	}
+	if htlc.LockID != "" {
+		indexes[htlcByLockIDPrefix] = []string{htlc.LockID, htlc.HashLock}
+	}
+	for indexPrefix, attributes := range indexes {
+		err := putIndexKey(ctx, indexPrefix, attributes)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, state := range []string{htlcStateLocked, htlcStateClaimed, htlcStateRefunded, holdStateExecuted, holdStateReleased} {
+		if state == htlc.State {
+			continue
+		}
+		err := delIndexKey(ctx, htlcByStatePrefix, []string{state, htlc.HashLock})
+		if err != nil {
+			return err
+		}
+	}
+	err := putIndexKey(ctx, htlcByStatePrefix, []string{htlc.State, htlc.HashLock})
+	if err != nil {
+		return err
+	}
+
+	expiryAttributes := []string{expiryIndexTime(htlc.TimeLock), htlc.HashLock}
+	if htlc.State == htlcStateLocked {
+		return putIndexKey(ctx, htlcByExpiryPrefix, expiryAttributes)
+	}
+
+	return delIndexKey(ctx, htlcByExpiryPrefix, expiryAttributes)
+}
+
+// putIndexKey writes the index key of the objectType and attributes
+func putIndexKey(ctx contractapi.TransactionContextInterface, indexPrefix string, attributes []string) error {
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(indexPrefix, attributes)
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", indexPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(indexKey, indexValue)
+	if err != nil {
+		return fmt.Errorf("failed to put %s index in the world state: %v", indexPrefix, err)
+	}
+
+	return nil
+}
+
+// delIndexKey removes the index key of the objectType and attributes
+func delIndexKey(ctx contractapi.TransactionContextInterface, indexPrefix string, attributes []string) error {
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(indexPrefix, attributes)
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", indexPrefix, err)
+	}
+
+	err = ctx.GetStub().DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s index from the world state: %v", indexPrefix, err)
+	}
+
+	return nil
+}
+
+// expiryIndexTime formats the timelock as zero padded unix nanoseconds, so that index keys sort in expiry order
+// parseTimeLock rejects timelocks before 1970, earlier times such as a cutoff in the past sort with the epoch
+func expiryIndexTime(timeLock time.Time) string {
+
+	if timeLock.Before(time.Unix(0, 0)) {
+		return fmt.Sprintf("%020d", 0)
+	}
+
+	return fmt.Sprintf("%020d", timeLock.UnixNano())
+}
+
+// parseQueryTime parses an RFC3339 timestamp, or a duration counted from now
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(duration), nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse time %s, expected an RFC3339 timestamp or a duration: %v", value, err)
+	}
+
+	return parsed.UTC(), nil
+}
@@ -0,0 +1,82 @@
+package chaincode_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+// hashLockOf returns the SHA256 hashLock of the preimage
+func hashLockOf(preimage string) string {
+	digest := sha256.Sum256([]byte(preimage))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestListHTLCs(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+	require.NoError(t, submit(stub, func() error { return contract.Transfer(bank, aliceID, "10") }))
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "1", hashLockOf("a"), "3h", "") }))
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "2", hashLockOf("b"), "1h", "") }))
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "3", hashLockOf("c"), "2h", "") }))
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(alice, bankID, "4", hashLockOf("d"), "30m", "") }))
+	require.NoError(t, submit(stub, func() error { return contract.Claim(alice, hashLockOf("c"), "c") }))
+
+	page, err := contract.ListHTLCsBySender(bank, bankID, 2, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 2)
+	require.NotEmpty(t, page.Bookmark)
+
+	page, err = contract.ListHTLCsBySender(bank, bankID, 2, page.Bookmark)
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Empty(t, page.Bookmark)
+
+	page, err = contract.ListHTLCsByRecipient(bank, bankID, 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, "4", page.Records[0].Amount)
+
+	page, err = contract.ListHTLCsByState(bank, "CLAIMED", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, hashLockOf("c"), page.Records[0].HashLock)
+
+	page, err = contract.ListHTLCsByState(bank, "LOCKED", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 3)
+
+	_, err = contract.ListHTLCsByState(bank, "PENDING", 10, "")
+	require.EqualError(t, err, "unknown HTLC state PENDING, expected LOCKED, CLAIMED, REFUNDED, EXECUTED or RELEASED")
+
+	// The claimed lock is no longer pending, the others are listed soonest first
+	page, err = contract.ListExpiringHTLCs(bank, "150m", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 2)
+	require.Equal(t, hashLockOf("d"), page.Records[0].HashLock)
+	require.Equal(t, hashLockOf("b"), page.Records[1].HashLock)
+	require.Empty(t, page.Bookmark)
+
+	// Timelocks within the same second keep their order
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "1", hashLockOf("e"), "20m700ms", "") }))
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "1", hashLockOf("f"), "20m200ms", "") }))
+	page, err = contract.ListExpiringHTLCs(bank, "20m500ms", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, hashLockOf("f"), page.Records[0].HashLock)
+
+	err = submit(stub, func() error {
+		return contract.TransferConditional(bank, aliceID, "1", hashLockOf("g"), "1969-12-31T23:59:59Z", "")
+	})
+	require.EqualError(t, err, "timeLock 1969-12-31T23:59:59Z must be between 1970 and 2262")
+}
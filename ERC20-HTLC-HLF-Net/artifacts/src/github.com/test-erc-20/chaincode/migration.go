@@ -0,0 +1,519 @@
+package chaincode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key name of the schema version of the world state, stored under the metadata object type
+const schemaVersionKey = "schemaVersion"
+
+// schemaVersion is the version of the records written by this contract, records without a schemaVersion field are version 0
+const schemaVersion = 2
+
+// Define the maximum number of records scanned by a GetMigrationPage call and upgraded by a Migrate call
+const maxMigratePageSize = 500
+
+// migratedObjectTypes are the objectTypes holding records, in the order Migrate walks them
+var migratedObjectTypes = []string{htlcPrefix, proposalPrefix, snapshotPrefix, mintUsagePrefix, txHistoryPrefix,
+	balancePrefix, allowancePrefix, htlcEscrowPrefix, lockedBalancePrefix, holdBalancePrefix, frozenPrefix,
+	accountMSPPrefix, permitKeyPrefix, permitNoncePrefix, mintQuotaPrefix, snapshotCheckpointPrefix, metadataPrefix}
+
+// scalarObjectTypes are the migrated objectTypes holding a single value, stored as a scalarRecord
+var scalarObjectTypes = map[string]bool{balancePrefix: true, allowancePrefix: true, htlcEscrowPrefix: true, lockedBalancePrefix: true,
+	holdBalancePrefix: true, frozenPrefix: true, accountMSPPrefix: true, permitKeyPrefix: true, permitNoncePrefix: true,
+	mintQuotaPrefix: true, snapshotCheckpointPrefix: true}
+
+// jsonMetadataKeys are the metadata keys holding JSON records, the other metadata values are scalars
+var jsonMetadataKeys = map[string]bool{feeScheduleKey: true, proposalPolicyKey: true}
+
+// scalarRecord holds a single value, such as a balance, an allowance or the token name
+// Before schema version 2 the value was stored bare, without the record
+type scalarRecord struct {
+	Value         string `json:"value"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// MigrationResult reports how many legacy keys were moved to each namespace
+type MigrationResult struct {
+	Balances int      `json:"balances"`
+	HTLCs    int      `json:"htlcs"`
+	Metadata int      `json:"metadata"`
+	Skipped  []string `json:"skipped"`
+}
+
+// MigrationPage is a page of the schema migration scan returned by GetMigrationPage
+// Keys are the hex encoded keys of the records of the page written with an older schema version, to pass to Migrate
+// Bookmark is empty once the scan is done, otherwise it is passed to the next GetMigrationPage call
+type MigrationPage struct {
+	Keys []string `json:"keys"`
+	// ObjectType is the objectType of the last record read
+	ObjectType string `json:"objectType"`
+	Scanned    int    `json:"scanned"`
+	Bookmark   string `json:"bookmark"`
+	Done       bool   `json:"done"`
+}
+
+// MigrationProgress reports the records upgraded by a Migrate call
+type MigrationProgress struct {
+	SchemaVersion int  `json:"schemaVersion"`
+	Upgraded      int  `json:"upgraded"`
+	Done          bool `json:"done"`
+}
+
+// MigrateLegacyKeys moves balances, HTLCs and token metadata stored under raw keys to their namespaced composite keys
+// Older versions of the contract stored balances under the client ID and HTLCs under the hashLock
+// Only clients with the admin role can run the migration. Running it again is harmless, as migrated keys are deleted
+func (s *SmartContract) MigrateLegacyKeys(ctx contractapi.TransactionContextInterface) (*MigrationResult, error) {
+
+	// Check admin authorization
+	_, err := requireRole(ctx, adminRole, "client is not authorized to migrate keys")
+	if err != nil {
+		return nil, err
+	}
+
+	// A range query over the whole key space only returns simple keys, composite keys are never included
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy keys from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	result := &MigrationResult{Skipped: []string{}}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read legacy keys from world state: %v", err)
+		}
+
+		key := queryResponse.Key
+		switch {
+		case key == nameKey || key == symbolKey || key == decimalsKey || key == totalSupplyKey:
+			_, err = migrateLegacyKey(ctx, key, metadataPrefix, key, encodeScalar(string(queryResponse.Value)))
+			result.Metadata++
+		case isLegacyHTLC(queryResponse.Value):
+			err = migrateLegacyHTLC(ctx, key, queryResponse.Value)
+			result.HTLCs++
+		case isLegacyBalance(queryResponse.Value):
+			_, err = migrateLegacyKey(ctx, key, balancePrefix, key, encodeScalar(string(queryResponse.Value)))
+			result.Balances++
+		default:
+			log.Printf("legacy key %s is not a balance, HTLC or metadata, leaving it in place", key)
+			result.Skipped = append(result.Skipped, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("migrated %d balances, %d HTLCs and %d metadata keys", result.Balances, result.HTLCs, result.Metadata)
+
+	return result, nil
+}
+
+// migrateLegacyKey moves the value of the raw legacyKey under the composite key of the objectType and key, and returns the value written
+// Balances and the total supply written under the namespaced key since the upgrade are added to the legacy value
+func migrateLegacyKey(ctx contractapi.TransactionContextInterface, legacyKey string, objectType string, key string, value []byte) ([]byte, error) {
+
+	currentBytes, err := getNamespacedState(ctx, objectType, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read namespaced key for %s: %v", key, err)
+	}
+
+	if currentBytes != nil {
+		switch {
+		case objectType == balancePrefix || key == totalSupplyKey:
+			merged, err := add(parseStoredAmount(currentBytes), parseStoredAmount(value))
+			if err != nil {
+				return nil, err
+			}
+			value = encodeScalar(merged.String())
+
+			// Keep the balances and total supply of earlier snapshots
+			err = checkpointSnapshot(ctx, objectType, key)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			// Metadata and HTLCs written since the upgrade take precedence over the legacy value
+			value = currentBytes
+		}
+	}
+
+	err = putNamespacedState(ctx, objectType, key, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write namespaced key for %s: %v", key, err)
+	}
+
+	err = ctx.GetStub().DelState(legacyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete legacy key %s: %v", legacyKey, err)
+	}
+
+	return value, nil
+}
+
+// migrateLegacyHTLC moves a HTLC stored under its raw hashLock, using the normalized hashLock when it is valid hex
+// Amounts of older HTLCs were stored as JSON numbers and are rewritten as base 10 strings, and their plaintext claim password is dropped
+// The index keys used by the HTLC list queries are written for the migrated HTLC
+func migrateLegacyHTLC(ctx contractapi.TransactionContextInterface, key string, value []byte) error {
+
+	record, err := decodeJSONRecord(value)
+	if err != nil {
+		return fmt.Errorf("failed to decode legacy HTLC %s: %v", key, err)
+	}
+
+	if amount, ok := record["amount"].(json.Number); ok {
+		record["amount"] = amount.String()
+	}
+	delete(record, "claimPassword")
+
+	hashLock, err := normalizeHashLock(key)
+	if err != nil {
+		hashLock = key
+	}
+	record["hashLock"] = hashLock
+
+	value, err = json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal HTLC details: %v", err)
+	}
+
+	migrated, err := migrateLegacyKey(ctx, key, htlcPrefix, hashLock, value)
+	if err != nil {
+		return err
+	}
+
+	// Older HTLCs have no index keys yet, they are written with them in the current schema
+	// The HTLC is decoded from the value written above, as a transaction does not read its own writes
+	htlc, err := unmarshalHTLC(migrated)
+	if err != nil {
+		return err
+	}
+
+	// The first releases paid the recipient when locking and kept no escrow account, so their HTLCs still locked
+	// could neither be claimed nor reverted: they are settled as claimed, the recipient already holds the tokens
+	if htlc.State == htlcStateLocked {
+		escrowBytes, err := getNamespacedState(ctx, htlcEscrowPrefix, htlc.HashLock)
+		if err != nil {
+			return fmt.Errorf("failed to read escrow account for hashLock %s from world state: %v", htlc.HashLock, err)
+		}
+		if escrowBytes == nil {
+			log.Printf("legacy HTLC %s has no escrow account, settling it as claimed", htlc.HashLock)
+			htlc.State = htlcStateClaimed
+		}
+	}
+
+	return putHTLC(ctx, htlc)
+}
+
+// decodeJSONRecord decodes a JSON object keeping numbers intact
+func decodeJSONRecord(value []byte) (map[string]interface{}, error) {
+
+	var record map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	err := decoder.Decode(&record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// encodeScalar returns the scalarRecord of the value at the current schema version
+func encodeScalar(value string) []byte {
+
+	// Error handling not needed since a struct of strings and ints always marshals
+	recordJSON, _ := json.Marshal(scalarRecord{Value: value, SchemaVersion: schemaVersion})
+	return recordJSON
+}
+
+// decodeScalar returns the value of a scalarRecord, or the value itself when it was stored bare
+func decodeScalar(valueBytes []byte) string {
+
+	var record scalarRecord
+	if len(valueBytes) > 0 && valueBytes[0] == '{' && json.Unmarshal(valueBytes, &record) == nil && record.SchemaVersion > 0 {
+		return record.Value
+	}
+
+	return string(valueBytes)
+}
+
+// isLegacyHTLC reports whether the value is a JSON encoded HTLC
+func isLegacyHTLC(value []byte) bool {
+
+	record, err := decodeJSONRecord(value)
+	if err != nil {
+		return false
+	}
+
+	hashLock, _ := record["hashLock"].(string)
+	sender, _ := record["sender"].(string)
+
+	return hashLock != "" && sender != ""
+}
+
+// isLegacyBalance reports whether the value is a base 10 integer amount
+func isLegacyBalance(value []byte) bool {
+
+	_, err := parseAmount(string(value))
+	return err == nil
+}
+
+// GetMigrationPage scans at most pageSize records for the ones written with an older schema version
+// It walks the JSON records of every objectType in key order, starting at the bookmark returned by the previous call
+// The scan uses paginated queries, which the peer only runs in read-only transactions, so it is evaluated and not submitted
+func (s *SmartContract) GetMigrationPage(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*MigrationPage, error) {
+
+	if pageSize < 1 || pageSize > maxMigratePageSize {
+		return nil, fmt.Errorf("page size must be between 1 and %d", maxMigratePageSize)
+	}
+
+	// The bookmark is the hex encoded composite key of the first record the previous call did not read
+	startKeyBytes, err := hex.DecodeString(bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bookmark %s", bookmark)
+	}
+	startKey := string(startKeyBytes)
+	first := 0
+	if startKey != "" {
+		first, err = migratedObjectTypeIndex(ctx, startKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bookmark %s", bookmark)
+		}
+	}
+
+	page := &MigrationPage{Keys: []string{}}
+	for _, objectType := range migratedObjectTypes[first:] {
+		resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(objectType, []string{}, pageSize-int32(page.Scanned), startKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s records: %v", objectType, err)
+		}
+
+		for resultsIterator.HasNext() {
+			queryResponse, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return nil, fmt.Errorf("failed to read %s records: %v", objectType, err)
+			}
+			page.Scanned++
+			page.ObjectType = objectType
+
+			upgraded, err := upgradeRecord(ctx, objectType, queryResponse.Key, queryResponse.Value)
+			if err != nil {
+				resultsIterator.Close()
+				return nil, err
+			}
+			if upgraded != nil {
+				page.Keys = append(page.Keys, hex.EncodeToString([]byte(queryResponse.Key)))
+			}
+		}
+		resultsIterator.Close()
+
+		if responseMetadata.GetBookmark() != "" {
+			page.Bookmark = hex.EncodeToString([]byte(responseMetadata.GetBookmark()))
+			break
+		}
+		if page.Scanned == int(pageSize) {
+			// The page ends with the objectType, the next page starts with the following one
+			if first+1 < len(migratedObjectTypes) {
+				nextKey, err := ctx.GetStub().CreateCompositeKey(migratedObjectTypes[first+1], []string{})
+				if err != nil {
+					return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", migratedObjectTypes[first+1], err)
+				}
+				page.Bookmark = hex.EncodeToString([]byte(nextKey))
+			}
+			break
+		}
+		first++
+		startKey = ""
+	}
+	page.Done = page.Bookmark == ""
+
+	return page, nil
+}
+
+// Migrate upgrades the records of the keys returned by GetMigrationPage to the current schema version in place
+// Pass done for the keys of the last page, to record the current schema version. Records written since the scan are
+// at the current version already and are left as they are. The contract reads records of every version,
+// so transactions keep running during the migration. A page conflicting with a concurrent transaction can be retried
+// Only clients with the admin role can run the migration. This function triggers a MigrationProgress event
+func (s *SmartContract) Migrate(ctx contractapi.TransactionContextInterface, keys []string, done bool) (*MigrationProgress, error) {
+
+	// Check admin authorization
+	admin, err := requireRole(ctx, adminRole, "client is not authorized to migrate keys")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) > maxMigratePageSize {
+		return nil, fmt.Errorf("page holds %d keys, the maximum is %d", len(keys), maxMigratePageSize)
+	}
+
+	progress := &MigrationProgress{SchemaVersion: schemaVersion, Done: done}
+	for _, key := range keys {
+		compositeKeyBytes, err := hex.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s", key)
+		}
+		compositeKey := string(compositeKeyBytes)
+		i, err := migratedObjectTypeIndex(ctx, compositeKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s", key)
+		}
+		objectType := migratedObjectTypes[i]
+
+		value, err := ctx.GetStub().GetState(compositeKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s record: %v", objectType, err)
+		}
+		if value == nil {
+			continue
+		}
+
+		upgraded, err := upgradeRecord(ctx, objectType, compositeKey, value)
+		if err != nil {
+			return nil, err
+		}
+		if upgraded == nil {
+			continue
+		}
+
+		err = ctx.GetStub().PutState(compositeKey, upgraded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to put upgraded %s record: %v", objectType, err)
+		}
+		progress.Upgraded++
+	}
+
+	if done {
+		err = putNamespacedState(ctx, metadataPrefix, schemaVersionKey, encodeScalar(strconv.Itoa(schemaVersion)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to set schema version: %v", err)
+		}
+	}
+
+	log.Printf("migration by %s upgraded %d of %d records to schema version %d", admin, progress.Upgraded, len(keys), schemaVersion)
+
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("MigrationProgress", progressJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return progress, nil
+}
+
+// migratedObjectTypeIndex returns the index in migratedObjectTypes of the objectType of the composite key
+func migratedObjectTypeIndex(ctx contractapi.TransactionContextInterface, compositeKey string) (int, error) {
+
+	objectType, _, err := ctx.GetStub().SplitCompositeKey(compositeKey)
+	if err != nil {
+		return 0, err
+	}
+	for i, migratedObjectType := range migratedObjectTypes {
+		if objectType == migratedObjectType {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("objectType %s holds no migrated records", objectType)
+}
+
+// SchemaVersion returns the schema version of the world state
+// It is set by Initialize and by the last page of Migrate, and is 0 for deployments that were never migrated
+func (s *SmartContract) SchemaVersion(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	versionBytes, err := getNamespacedState(ctx, metadataPrefix, schemaVersionKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version from world state: %v", err)
+	}
+	if versionBytes == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(decodeScalar(versionBytes))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %s: %v", versionBytes, err)
+	}
+
+	return version, nil
+}
+
+// upgradeRecord returns the record of the objectType upgraded to the current schema version, nil when it is up to date
+// Fields the contract does not know are kept
+func upgradeRecord(ctx contractapi.TransactionContextInterface, objectType string, key string, value []byte) ([]byte, error) {
+
+	if objectType == metadataPrefix {
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split the composite key %s: %v", key, err)
+		}
+		if len(attributes) == 0 || !jsonMetadataKeys[attributes[0]] {
+			return upgradeScalar(objectType, value), nil
+		}
+	}
+	if scalarObjectTypes[objectType] {
+		return upgradeScalar(objectType, value), nil
+	}
+
+	record, err := decodeJSONRecord(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s record: %v", objectType, err)
+	}
+	if version, ok := record["schemaVersion"].(json.Number); ok {
+		versionNumber, err := version.Int64()
+		if err == nil && versionNumber >= schemaVersion {
+			return nil, nil
+		}
+	}
+
+	if objectType == htlcPrefix {
+		// Version 0 HTLCs may carry a numeric amount, and the claimed/reverted flags and plaintext claim password of the first releases
+		if amount, ok := record["amount"].(json.Number); ok {
+			record["amount"] = amount.String()
+		}
+		htlcBytes, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal HTLC details: %v", err)
+		}
+		htlc, err := unmarshalHTLC(htlcBytes)
+		if err != nil {
+			return nil, err
+		}
+		record["state"] = htlc.State
+		delete(record, "claimed")
+		delete(record, "reverted")
+		delete(record, "claimPassword")
+	}
+
+	record["schemaVersion"] = schemaVersion
+
+	return json.Marshal(record)
+}
+
+// upgradeScalar returns the scalarRecord of a value stored bare, nil when it is a scalarRecord already
+// Permit keys were stored as DER bytes and are base64 encoded in the record
+func upgradeScalar(objectType string, value []byte) []byte {
+
+	scalar := decodeScalar(value)
+	if scalar != string(value) {
+		return nil
+	}
+	if objectType == permitKeyPrefix {
+		scalar = base64.StdEncoding.EncodeToString(value)
+	}
+
+	return encodeScalar(scalar)
+}
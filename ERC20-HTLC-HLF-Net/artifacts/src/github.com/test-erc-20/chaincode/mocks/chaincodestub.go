@@ -0,0 +1,303 @@
+package mocks
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const compositeKeyNamespace = "\x00"
+
+// ChaincodeEvent is an event set by the chaincode during a transaction
+type ChaincodeEvent struct {
+	Name    string
+	Payload []byte
+}
+
+// ChaincodeStub is an in-memory implementation of shim.ChaincodeStubInterface for unit tests
+// Stub functions that are not implemented panic when called through the embedded interface
+// Like on the peer, the writes of a transaction are not visible to its own reads: State, History and PrivateData
+// hold the committed world state, and the writes of the current transaction are buffered until Commit or Rollback
+type ChaincodeStub struct {
+	shim.ChaincodeStubInterface
+
+	ChannelID     string
+	ChaincodeName string
+	TxID          string
+	TxTimestamp   *timestamppb.Timestamp
+	State         map[string][]byte
+	History       map[string][]*queryresult.KeyModification
+	PrivateData   map[string]map[string][]byte
+	Transient     map[string][]byte
+	Chaincodes    map[string]func(args [][]byte) peer.Response
+	Event         *ChaincodeEvent
+
+	// writes and privateWrites are the writes of the current transaction, a nil value deletes the key
+	writes        map[string][]byte
+	privateWrites map[string]map[string][]byte
+}
+
+// NewChaincodeStub returns a stub with an empty world state
+func NewChaincodeStub() *ChaincodeStub {
+	return &ChaincodeStub{
+		ChannelID:     "mychannel",
+		ChaincodeName: "test-erc20-cc-1",
+		TxID:          "tx1",
+		TxTimestamp:   timestamppb.Now(),
+		State:         make(map[string][]byte),
+		History:       make(map[string][]*queryresult.KeyModification),
+		PrivateData:   make(map[string]map[string][]byte),
+		Transient:     make(map[string][]byte),
+		Chaincodes:    make(map[string]func(args [][]byte) peer.Response),
+
+		writes:        make(map[string][]byte),
+		privateWrites: make(map[string]map[string][]byte),
+	}
+}
+
+// Commit applies the writes of the current transaction to the world state, as the peer does for a valid transaction
+func (stub *ChaincodeStub) Commit() {
+	for key, value := range stub.writes {
+		if value == nil {
+			if _, ok := stub.State[key]; ok {
+				stub.History[key] = append(stub.History[key], &queryresult.KeyModification{TxId: stub.TxID, Timestamp: stub.TxTimestamp, IsDelete: true})
+			}
+			delete(stub.State, key)
+			continue
+		}
+		stub.State[key] = value
+		stub.History[key] = append(stub.History[key], &queryresult.KeyModification{TxId: stub.TxID, Value: value, Timestamp: stub.TxTimestamp})
+	}
+	for collection, values := range stub.privateWrites {
+		if stub.PrivateData[collection] == nil {
+			stub.PrivateData[collection] = make(map[string][]byte)
+		}
+		for key, value := range values {
+			stub.PrivateData[collection][key] = value
+		}
+	}
+	stub.writes = make(map[string][]byte)
+	stub.privateWrites = make(map[string]map[string][]byte)
+}
+
+// Rollback discards the writes and the event of the current transaction, as for a transaction the peer does not commit
+func (stub *ChaincodeStub) Rollback() {
+	stub.writes = make(map[string][]byte)
+	stub.privateWrites = make(map[string]map[string][]byte)
+	stub.Event = nil
+}
+
+// GetChannelID returns the channel of the current transaction
+func (stub *ChaincodeStub) GetChannelID() string {
+	return stub.ChannelID
+}
+
+// GetTxID returns the ID of the current transaction
+func (stub *ChaincodeStub) GetTxID() string {
+	return stub.TxID
+}
+
+// GetSignedProposal returns a proposal invoking ChaincodeName on ChannelID, with the headers the peer fills in
+// The signature and the creator are left empty
+func (stub *ChaincodeStub) GetSignedProposal() (*peer.SignedProposal, error) {
+	extension, err := proto.Marshal(&peer.ChaincodeHeaderExtension{ChaincodeId: &peer.ChaincodeID{Name: stub.ChaincodeName}})
+	if err != nil {
+		return nil, err
+	}
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChannelId: stub.ChannelID,
+		TxId:      stub.TxID,
+		Timestamp: stub.TxTimestamp,
+		Extension: extension,
+	})
+	if err != nil {
+		return nil, err
+	}
+	header, err := proto.Marshal(&common.Header{ChannelHeader: channelHeader})
+	if err != nil {
+		return nil, err
+	}
+	proposal, err := proto.Marshal(&peer.Proposal{Header: header})
+	if err != nil {
+		return nil, err
+	}
+	return &peer.SignedProposal{ProposalBytes: proposal}, nil
+}
+
+// GetTxTimestamp returns the timestamp of the current transaction
+func (stub *ChaincodeStub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return stub.TxTimestamp, nil
+}
+
+// GetState returns the committed value of the key, or nil if it does not exist
+func (stub *ChaincodeStub) GetState(key string) ([]byte, error) {
+	return stub.State[key], nil
+}
+
+// PutState writes the value of the key when the transaction commits
+func (stub *ChaincodeStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	stub.writes[key] = value
+	return nil
+}
+
+// DelState removes the key when the transaction commits
+func (stub *ChaincodeStub) DelState(key string) error {
+	stub.writes[key] = nil
+	return nil
+}
+
+// InvokeChaincode calls the chaincode registered in Chaincodes under "channel/name", an empty channel is the channel of the stub
+func (stub *ChaincodeStub) InvokeChaincode(name string, args [][]byte, channel string) peer.Response {
+	if channel == "" {
+		channel = stub.ChannelID
+	}
+	invoke, ok := stub.Chaincodes[channel+"/"+name]
+	if !ok {
+		return peer.Response{Status: 500, Message: fmt.Sprintf("chaincode %s not found on channel %s", name, channel)}
+	}
+	return invoke(args)
+}
+
+// GetTransient returns the transient map of the current transaction proposal
+func (stub *ChaincodeStub) GetTransient() (map[string][]byte, error) {
+	return stub.Transient, nil
+}
+
+// GetPrivateData returns the committed value of the key in the collection, or nil if it does not exist
+func (stub *ChaincodeStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return stub.PrivateData[collection][key], nil
+}
+
+// GetPrivateDataHash returns the SHA256 hash of the value of the key in the collection, as stored on the public ledger
+func (stub *ChaincodeStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value, ok := stub.PrivateData[collection][key]
+	if !ok {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// PutPrivateData writes the value of the key in the collection when the transaction commits
+func (stub *ChaincodeStub) PutPrivateData(collection string, key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if stub.privateWrites[collection] == nil {
+		stub.privateWrites[collection] = make(map[string][]byte)
+	}
+	stub.privateWrites[collection][key] = value
+	return nil
+}
+
+// GetHistoryForKey returns the modifications of the key, newest first like the peer
+func (stub *ChaincodeStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	modifications := stub.History[key]
+	results := make([]*queryresult.KeyModification, 0, len(modifications))
+	for i := len(modifications) - 1; i >= 0; i-- {
+		results = append(results, modifications[i])
+	}
+	return &HistoryQueryIterator{results: results}, nil
+}
+
+// GetStateByRange returns the committed simple keys in the range [startKey, endKey), an empty endKey is unbounded
+// Like the peer, composite keys are never returned by a range query
+func (stub *ChaincodeStub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if strings.HasPrefix(startKey, compositeKeyNamespace) || strings.HasPrefix(endKey, compositeKeyNamespace) {
+		return nil, fmt.Errorf("range query keys must not be composite keys")
+	}
+
+	var results []*queryresult.KV
+	for key, value := range stub.State {
+		if strings.HasPrefix(key, compositeKeyNamespace) || key < startKey || (endKey != "" && key >= endKey) {
+			continue
+		}
+		results = append(results, &queryresult.KV{Key: key, Value: value})
+	}
+	return newStateQueryIterator(results), nil
+}
+
+// GetStateByPartialCompositeKey returns the committed composite keys of the objectType starting with the given attributes
+func (stub *ChaincodeStub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	iterator, _, err := stub.GetStateByPartialCompositeKeyWithPagination(objectType, attributes, 0, "")
+	return iterator, err
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns a page of the committed composite keys of the objectType starting with the given attributes
+// As on the peer, the bookmark is the key to resume from and a pageSize of 0 returns all results
+func (stub *ChaincodeStub) GetStateByPartialCompositeKeyWithPagination(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	prefix, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	for key := range stub.State {
+		if strings.HasPrefix(key, prefix) && key >= bookmark {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	nextBookmark := ""
+	if pageSize > 0 && len(keys) > int(pageSize) {
+		nextBookmark = keys[pageSize]
+		keys = keys[:pageSize]
+	}
+
+	results := make([]*queryresult.KV, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, &queryresult.KV{Key: key, Value: stub.State[key]})
+	}
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(results)), Bookmark: nextBookmark}
+	return newStateQueryIterator(results), metadata, nil
+}
+
+// CreateCompositeKey combines the object type and attributes the same way the peer shim does
+func (stub *ChaincodeStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	for _, part := range append([]string{objectType}, attributes...) {
+		if !utf8.ValidString(part) {
+			return "", fmt.Errorf("not a valid utf8 string: [%x]", part)
+		}
+		if strings.ContainsRune(part, 0) || strings.ContainsRune(part, utf8.MaxRune) {
+			return "", fmt.Errorf("input contains unicode %#U or %#U", 0, utf8.MaxRune)
+		}
+	}
+
+	key := compositeKeyNamespace + objectType + string(rune(0))
+	for _, attribute := range attributes {
+		key += attribute + string(rune(0))
+	}
+	return key, nil
+}
+
+// SplitCompositeKey splits a composite key into its object type and attributes
+func (stub *ChaincodeStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	parts := strings.Split(strings.TrimPrefix(compositeKey, compositeKeyNamespace), string(rune(0)))
+	if len(parts) < 2 {
+		return "", nil, fmt.Errorf("invalid composite key %q", compositeKey)
+	}
+	return parts[0], parts[1 : len(parts)-1], nil
+}
+
+// SetEvent records the event, replacing any event set earlier in the transaction like the peer does
+func (stub *ChaincodeStub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	stub.Event = &ChaincodeEvent{Name: name, Payload: payload}
+	return nil
+}
@@ -0,0 +1,47 @@
+package mocks
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// ClientIdentity is a fixed implementation of cid.ClientIdentity for unit tests
+type ClientIdentity struct {
+	ID          string
+	MSPID       string
+	Attributes  map[string]string
+	Certificate *x509.Certificate
+}
+
+// GetID returns the ID of the client
+func (ci *ClientIdentity) GetID() (string, error) {
+	return ci.ID, nil
+}
+
+// GetMSPID returns the MSP ID of the client
+func (ci *ClientIdentity) GetMSPID() (string, error) {
+	return ci.MSPID, nil
+}
+
+// GetAttributeValue returns the value of the certificate attribute
+func (ci *ClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := ci.Attributes[attrName]
+	return value, found, nil
+}
+
+// AssertAttributeValue checks that the certificate attribute has the given value
+func (ci *ClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	value, found := ci.Attributes[attrName]
+	if !found {
+		return fmt.Errorf("attribute '%s' was not found", attrName)
+	}
+	if value != attrValue {
+		return fmt.Errorf("attribute '%s' equals '%s', not '%s'", attrName, value, attrValue)
+	}
+	return nil
+}
+
+// GetX509Certificate returns the certificate of the client
+func (ci *ClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return ci.Certificate, nil
+}
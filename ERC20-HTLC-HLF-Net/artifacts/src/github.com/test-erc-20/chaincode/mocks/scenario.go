@@ -0,0 +1,125 @@
+package mocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Scenario runs the transactions of several client identities against a single world state, like a channel with one peer
+// Every transaction gets its own ID and a timestamp one second after the previous one. Its writes are staged until it
+// ends: a transaction does not read its own writes, and the writes of a failed transaction are discarded, as the peer
+// would not commit it
+type Scenario struct {
+	Stub *ChaincodeStub
+
+	txCount int
+}
+
+// TxResult is the outcome of a transaction run by a Scenario
+type TxResult struct {
+	TxID string
+	Err  error
+	// Event is the event set by the transaction, nil if it set none or failed
+	Event *ChaincodeEvent
+	// Changes maps the keys written by the transaction to their change, composite keys are written as objectType~attribute~...
+	Changes map[string]StateChange
+}
+
+// StateChange is the change of a key of the world state made by a transaction, values are empty when the key did not exist
+// Values stored as scalar records, {"value":...,"schemaVersion":...}, are reported by their value
+type StateChange struct {
+	Before  string
+	After   string
+	Deleted bool
+}
+
+// NewScenario returns a scenario with an empty world state
+func NewScenario() *Scenario {
+	return &Scenario{Stub: NewChaincodeStub()}
+}
+
+// Identity returns a transaction context submitting as the client with the given ID and MSP ID
+func (sc *Scenario) Identity(id string, mspID string) *TransactionContext {
+	return &TransactionContext{
+		Stub:           sc.Stub,
+		ClientIdentity: &ClientIdentity{ID: id, MSPID: mspID},
+	}
+}
+
+// AdminIdentity returns a transaction context submitting as an admin of its organization, registered as such with a Fabric CA
+func (sc *Scenario) AdminIdentity(id string, mspID string) *TransactionContext {
+	ctx := sc.Identity(id, mspID)
+	ctx.ClientIdentity.Attributes = map[string]string{"hf.Type": "admin"}
+	return ctx
+}
+
+// Advance moves the clock of the next transactions forward, for example past a timelock
+func (sc *Scenario) Advance(duration time.Duration) {
+	sc.Stub.TxTimestamp = timestamppb.New(sc.Stub.TxTimestamp.AsTime().Add(duration))
+}
+
+// Submit runs the transaction in fn, which calls one contract function, with a new transaction ID and timestamp
+// It reports the event and state changes of the transaction like Run
+func (sc *Scenario) Submit(fn func() error) *TxResult {
+	sc.txCount++
+	sc.Stub.TxID = fmt.Sprintf("tx%d", sc.txCount)
+	sc.Advance(time.Second)
+
+	return sc.Run(fn)
+}
+
+// Run runs the transaction in fn, which calls one contract function, keeping the transaction ID and timestamp of the stub
+// The staged writes are committed only when fn succeeds
+func (sc *Scenario) Run(fn func() error) *TxResult {
+	sc.Stub.Rollback()
+
+	result := &TxResult{TxID: sc.Stub.TxID, Changes: make(map[string]StateChange)}
+	result.Err = fn()
+	if result.Err != nil {
+		sc.Stub.Rollback()
+		return result
+	}
+
+	result.Event = sc.Stub.Event
+	for key, after := range sc.Stub.writes {
+		before, existed := sc.Stub.State[key]
+		switch {
+		case after == nil && existed:
+			result.Changes[ReadableKey(key)] = StateChange{Before: ReadableValue(before), Deleted: true}
+		case after != nil && (!existed || string(after) != string(before)):
+			result.Changes[ReadableKey(key)] = StateChange{Before: ReadableValue(before), After: ReadableValue(after)}
+		}
+	}
+	sc.Stub.Commit()
+
+	return result
+}
+
+// Decode unmarshals the JSON payload of the event
+func (event *ChaincodeEvent) Decode(v interface{}) error {
+	return json.Unmarshal(event.Payload, v)
+}
+
+// ReadableKey writes a composite key as objectType~attribute~..., simple keys are returned unchanged
+func ReadableKey(key string) string {
+	if !strings.HasPrefix(key, compositeKeyNamespace) {
+		return key
+	}
+	return strings.TrimSuffix(strings.ReplaceAll(strings.TrimPrefix(key, compositeKeyNamespace), string(rune(0)), "~"), "~")
+}
+
+// ReadableValue returns the value of a scalar record, other values are returned unchanged
+func ReadableValue(value []byte) string {
+	var record struct {
+		Value         *string `json:"value"`
+		SchemaVersion int     `json:"schemaVersion"`
+	}
+	if json.Unmarshal(value, &record) != nil || record.Value == nil || record.SchemaVersion == 0 {
+		return string(value)
+	}
+	return *record.Value
+}
@@ -0,0 +1,67 @@
+package mocks
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// StateQueryIterator iterates over a snapshot of query results in key order
+type StateQueryIterator struct {
+	results []*queryresult.KV
+	closed  bool
+}
+
+func newStateQueryIterator(results []*queryresult.KV) *StateQueryIterator {
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return &StateQueryIterator{results: results}
+}
+
+// HasNext reports whether the iterator has more results
+func (it *StateQueryIterator) HasNext() bool {
+	return !it.closed && len(it.results) > 0
+}
+
+// Next returns the next result
+func (it *StateQueryIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	result := it.results[0]
+	it.results = it.results[1:]
+	return result, nil
+}
+
+// Close releases the iterator
+func (it *StateQueryIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+// HistoryQueryIterator iterates over the modifications of a key
+type HistoryQueryIterator struct {
+	results []*queryresult.KeyModification
+	closed  bool
+}
+
+// HasNext reports whether the iterator has more results
+func (it *HistoryQueryIterator) HasNext() bool {
+	return !it.closed && len(it.results) > 0
+}
+
+// Next returns the next result
+func (it *HistoryQueryIterator) Next() (*queryresult.KeyModification, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	result := it.results[0]
+	it.results = it.results[1:]
+	return result, nil
+}
+
+// Close releases the iterator
+func (it *HistoryQueryIterator) Close() error {
+	it.closed = true
+	return nil
+}
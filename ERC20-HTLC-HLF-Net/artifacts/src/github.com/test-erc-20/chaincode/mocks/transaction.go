@@ -0,0 +1,22 @@
+package mocks
+
+import (
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// TransactionContext implements contractapi.TransactionContextInterface for unit tests
+type TransactionContext struct {
+	Stub           *ChaincodeStub
+	ClientIdentity *ClientIdentity
+}
+
+// GetStub returns the stub of the transaction
+func (ctx *TransactionContext) GetStub() shim.ChaincodeStubInterface {
+	return ctx.Stub
+}
+
+// GetClientIdentity returns the identity submitting the transaction
+func (ctx *TransactionContext) GetClientIdentity() cid.ClientIdentity {
+	return ctx.ClientIdentity
+}
@@ -0,0 +1,216 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key name of the pause flag, stored under the metadata object type
+const pausedKey = "paused"
+
+// Define objectType name for frozen accounts
+const frozenPrefix = "frozen"
+
+// pauseEvent is the payload of the Paused, Unpaused, AccountFrozen and AccountUnfrozen events
+type pauseEvent struct {
+	Account string `json:"account,omitempty"`
+	Sender  string `json:"sender"`
+}
+
+// Pause stops all token movements: transfers, mints, burns and HTLC operations
+// Queries keep working while the contract is paused
+// Only clients with the pauser role can pause. This function triggers a Paused event
+func (s *SmartContract) Pause(ctx contractapi.TransactionContextInterface) error {
+
+	return setPaused(ctx, true)
+}
+
+// Unpause resumes token movements after a Pause
+// Only clients with the pauser role can unpause. This function triggers an Unpaused event
+func (s *SmartContract) Unpause(ctx contractapi.TransactionContextInterface) error {
+
+	return setPaused(ctx, false)
+}
+
+// Paused returns whether the contract is paused
+func (s *SmartContract) Paused(ctx contractapi.TransactionContextInterface) (bool, error) {
+
+	return pausedHelper(ctx)
+}
+
+// FreezeAccount stops all token movements from and to the account, for example when its key is compromised
+// Only clients with the pauser role can freeze accounts. This function triggers an AccountFrozen event
+func (s *SmartContract) FreezeAccount(ctx contractapi.TransactionContextInterface, account string) error {
+
+	return setFrozen(ctx, account, true)
+}
+
+// UnfreezeAccount resumes token movements of a frozen account
+// Only clients with the pauser role can unfreeze accounts. This function triggers an AccountUnfrozen event
+func (s *SmartContract) UnfreezeAccount(ctx contractapi.TransactionContextInterface, account string) error {
+
+	return setFrozen(ctx, account, false)
+}
+
+// IsFrozen returns whether the account is frozen
+func (s *SmartContract) IsFrozen(ctx contractapi.TransactionContextInterface, account string) (bool, error) {
+
+	return frozenHelper(ctx, account)
+}
+
+// checkNotPaused returns an error when the contract is paused
+func checkNotPaused(ctx contractapi.TransactionContextInterface) error {
+
+	paused, err := pausedHelper(ctx)
+	if err != nil {
+		return err
+	}
+	if paused {
+		return fmt.Errorf("contract is paused")
+	}
+
+	return nil
+}
+
+// checkNotFrozen returns an error when any of the accounts is frozen
+func checkNotFrozen(ctx contractapi.TransactionContextInterface, accounts ...string) error {
+
+	for _, account := range accounts {
+		frozen, err := frozenHelper(ctx, account)
+		if err != nil {
+			return err
+		}
+		if frozen {
+			return fmt.Errorf("account %s is frozen", account)
+		}
+	}
+
+	return nil
+}
+
+// checkTransferable returns an error when the contract is paused or any of the accounts is frozen
+func checkTransferable(ctx contractapi.TransactionContextInterface, accounts ...string) error {
+
+	err := checkNotPaused(ctx)
+	if err != nil {
+		return err
+	}
+
+	return checkNotFrozen(ctx, accounts...)
+}
+
+// pausedHelper reads the pause flag from the world state
+func pausedHelper(ctx contractapi.TransactionContextInterface) (bool, error) {
+
+	pausedBytes, err := getNamespacedState(ctx, metadataPrefix, pausedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read pause flag from world state: %v", err)
+	}
+
+	return pausedBytes != nil, nil
+}
+
+// frozenHelper reads the frozen flag of the account from the world state
+func frozenHelper(ctx contractapi.TransactionContextInterface, account string) (bool, error) {
+
+	frozenBytes, err := getNamespacedState(ctx, frozenPrefix, account)
+	if err != nil {
+		return false, fmt.Errorf("failed to read frozen flag of %s from world state: %v", account, err)
+	}
+
+	return frozenBytes != nil, nil
+}
+
+// setPaused updates the pause flag and emits the Paused or Unpaused event
+func setPaused(ctx contractapi.TransactionContextInterface, paused bool) error {
+
+	// Check pauser authorization
+	pauser, err := requireRole(ctx, pauserRole, "client is not authorized to pause the contract")
+	if err != nil {
+		return err
+	}
+
+	currentlyPaused, err := pausedHelper(ctx)
+	if err != nil {
+		return err
+	}
+	if currentlyPaused == paused {
+		if paused {
+			return fmt.Errorf("contract is already paused")
+		}
+		return fmt.Errorf("contract is not paused")
+	}
+
+	eventName := "Paused"
+	if paused {
+		err = putNamespacedState(ctx, metadataPrefix, pausedKey, encodeScalar("true"))
+	} else {
+		eventName = "Unpaused"
+		err = delNamespacedState(ctx, metadataPrefix, pausedKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update pause flag: %v", err)
+	}
+
+	log.Printf("contract paused set to %t by %s", paused, pauser)
+
+	return emitPauseEvent(ctx, eventName, pauseEvent{Sender: pauser})
+}
+
+// setFrozen updates the frozen flag of the account and emits the AccountFrozen or AccountUnfrozen event
+func setFrozen(ctx contractapi.TransactionContextInterface, account string, frozen bool) error {
+
+	// Check pauser authorization
+	pauser, err := requireRole(ctx, pauserRole, "client is not authorized to freeze accounts")
+	if err != nil {
+		return err
+	}
+
+	if account == "" {
+		return fmt.Errorf("account must not be empty")
+	}
+
+	currentlyFrozen, err := frozenHelper(ctx, account)
+	if err != nil {
+		return err
+	}
+	if currentlyFrozen == frozen {
+		if frozen {
+			return fmt.Errorf("account %s is already frozen", account)
+		}
+		return fmt.Errorf("account %s is not frozen", account)
+	}
+
+	eventName := "AccountFrozen"
+	if frozen {
+		err = putNamespacedState(ctx, frozenPrefix, account, encodeScalar("true"))
+	} else {
+		eventName = "AccountUnfrozen"
+		err = delNamespacedState(ctx, frozenPrefix, account)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update frozen flag of %s: %v", account, err)
+	}
+
+	log.Printf("account %s frozen set to %t by %s", account, frozen, pauser)
+
+	return emitPauseEvent(ctx, eventName, pauseEvent{Account: account, Sender: pauser})
+}
+
+// emitPauseEvent emits the named pause or freeze event
+func emitPauseEvent(ctx contractapi.TransactionContextInterface, name string, payload pauseEvent) error {
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
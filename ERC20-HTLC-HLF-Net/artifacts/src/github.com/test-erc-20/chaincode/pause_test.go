@@ -0,0 +1,89 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+func TestPause(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	err := submit(stub, func() error { return contract.Pause(bank) })
+	require.EqualError(t, err, "client is not authorized to pause the contract")
+
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "pauser", bankID) }))
+	require.NoError(t, submit(stub, func() error { return contract.Pause(bank) }))
+	require.Equal(t, "Paused", stub.Event.Name)
+
+	err = submit(stub, func() error { return contract.Transfer(bank, aliceID, "10") })
+	require.EqualError(t, err, "failed to transfer: contract is paused")
+
+	err = submit(stub, func() error { return contract.Mint(bank, "10") })
+	require.EqualError(t, err, "failed to mint: contract is paused")
+
+	err = submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "10", secretHashLock, "1h", "") })
+	require.EqualError(t, err, "contract is paused")
+
+	// Reads keep working while paused
+	paused, err := contract.Paused(alice)
+	require.NoError(t, err)
+	require.True(t, paused)
+
+	bankBalance, err := contract.BalanceOf(alice, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "100", bankBalance.Available)
+
+	require.NoError(t, submit(stub, func() error { return contract.Unpause(bank) }))
+	require.Equal(t, "Unpaused", stub.Event.Name)
+	require.NoError(t, submit(stub, func() error { return contract.Transfer(bank, aliceID, "10") }))
+}
+
+func TestFreezeAccount(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	bondx := newContext(stub, bondxID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "pauser", bankID) }))
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+	require.NoError(t, submit(stub, func() error { return contract.Transfer(bank, aliceID, "50") }))
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "10", secretHashLock, "1h", "") }))
+	require.NoError(t, submit(stub, func() error { return contract.Approve(alice, bondxID, "20") }))
+
+	require.NoError(t, submit(stub, func() error { return contract.FreezeAccount(bank, aliceID) }))
+	require.Equal(t, "AccountFrozen", stub.Event.Name)
+
+	err := submit(stub, func() error { return contract.Transfer(alice, bankID, "10") })
+	require.EqualError(t, err, "failed to transfer: account "+aliceID+" is frozen")
+
+	err = submit(stub, func() error { return contract.Transfer(bank, aliceID, "10") })
+	require.EqualError(t, err, "failed to transfer: account "+aliceID+" is frozen")
+
+	err = submit(stub, func() error { return contract.TransferFrom(bondx, aliceID, bankID, "10") })
+	require.EqualError(t, err, "failed to transfer: account "+aliceID+" is frozen")
+
+	err = submit(stub, func() error { return contract.Claim(bank, secretHashLock, "secret") })
+	require.EqualError(t, err, "account "+aliceID+" is frozen")
+
+	frozen, err := contract.IsFrozen(bank, aliceID)
+	require.NoError(t, err)
+	require.True(t, frozen)
+
+	// Other accounts are not affected
+	require.NoError(t, submit(stub, func() error { return contract.Transfer(bank, bondxID, "10") }))
+
+	require.NoError(t, submit(stub, func() error { return contract.UnfreezeAccount(bank, aliceID) }))
+	require.Equal(t, "AccountUnfrozen", stub.Event.Name)
+	require.NoError(t, submit(stub, func() error { return contract.Claim(bank, secretHashLock, "secret") }))
+}
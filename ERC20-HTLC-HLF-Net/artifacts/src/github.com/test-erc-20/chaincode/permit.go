@@ -0,0 +1,261 @@
+package chaincode
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Define objectType names for permit public keys and nonces
+const permitKeyPrefix = "permitKey"
+const permitNoncePrefix = "permitNonce"
+
+// Define the domain of the permit message, so that permit signatures can not be reused for other purposes
+const permitDomain = "test-erc-20:Permit"
+
+// RegisterPermitKey records the public key of the calling client's X.509 certificate
+// Every transaction moving tokens or setting an allowance records it too, so it is only needed by owners that never submitted one
+// Permit only accepts signatures of owners whose key is recorded, which must be an ECDSA key
+func (s *SmartContract) RegisterPermitKey(ctx contractapi.TransactionContextInterface) error {
+
+	certificate, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return fmt.Errorf("failed to get client certificate: %v", err)
+	}
+	if certificate == nil {
+		return fmt.Errorf("client has no X.509 certificate")
+	}
+
+	if _, ok := certificate.PublicKey.(*ecdsa.PublicKey); !ok {
+		return fmt.Errorf("client certificate does not hold an ECDSA public key")
+	}
+
+	return recordClientKey(ctx)
+}
+
+// Permit sets the allowance of the spender on the owner's account, authorized by a signature of the owner
+// instead of a transaction of the owner, so that a relayer can submit the approval on the owner's behalf
+// signature is the base64 encoded ASN.1 ECDSA signature of the SHA256 digest of the message returned by PermitMessage
+// deadline is an RFC3339 timestamp after which the permit is no longer accepted, and nonce must equal Nonces(owner)
+// This function triggers an Approval event
+func (s *SmartContract) Permit(ctx contractapi.TransactionContextInterface, owner string, spender string, value string, deadline string, nonce int, signature string) error {
+
+	allowanceValue, err := parseAmount(value)
+	if err != nil {
+		return err
+	}
+
+	deadlineTime, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		return fmt.Errorf("failed to parse deadline %s, expected an RFC3339 timestamp: %v", deadline, err)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if now.After(deadlineTime) {
+		return fmt.Errorf("permit expired at %s", deadlineTime.UTC().Format(time.RFC3339))
+	}
+
+	// The nonce is consumed by a successful permit, so a signature can only be used once
+	currentNonce, err := permitNonceHelper(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if nonce != currentNonce {
+		return fmt.Errorf("invalid permit nonce %d, expected %d", nonce, currentNonce)
+	}
+
+	publicKeyBytes, err := permitKeyHelper(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if publicKeyBytes == nil {
+		return fmt.Errorf("owner %s has no permit key, it is recorded by the first transaction of the owner", owner)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(publicKeyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse permit key of %s: %v", owner, err)
+	}
+	ecdsaPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("permit key of %s is not an ECDSA public key", owner)
+	}
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode permit signature: %v", err)
+	}
+
+	message, err := permitMessage(ctx, owner, spender, allowanceValue.String(), deadline, nonce)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(message))
+	if !ecdsa.VerifyASN1(ecdsaPublicKey, digest[:], signatureBytes) {
+		return fmt.Errorf("invalid permit signature")
+	}
+
+	err = putNamespacedState(ctx, permitNoncePrefix, owner, encodeScalar(strconv.Itoa(currentNonce+1)))
+	if err != nil {
+		return fmt.Errorf("failed to update permit nonce of %s: %v", owner, err)
+	}
+
+	return approveHelper(ctx, owner, spender, allowanceValue)
+}
+
+// PermitMessage returns the canonical message the owner signs to authorize a Permit
+func (s *SmartContract) PermitMessage(ctx contractapi.TransactionContextInterface, owner string, spender string, value string, deadline string, nonce int) (string, error) {
+
+	allowanceValue, err := parseAmount(value)
+	if err != nil {
+		return "", err
+	}
+
+	return permitMessage(ctx, owner, spender, allowanceValue.String(), deadline, nonce)
+}
+
+// Nonces returns the nonce the next Permit of the owner must use
+func (s *SmartContract) Nonces(ctx contractapi.TransactionContextInterface, owner string) (int, error) {
+
+	return permitNonceHelper(ctx, owner)
+}
+
+// permitMessage builds the canonical permit message, bound to the channel and chaincode name so it can not be replayed
+// on another deployment of the contract, which has its own nonces
+func permitMessage(ctx contractapi.TransactionContextInterface, owner string, spender string, value string, deadline string, nonce int) (string, error) {
+
+	chaincode, err := chaincodeName(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s\nchannel:%s\nchaincode:%s\nowner:%s\nspender:%s\nvalue:%s\ndeadline:%s\nnonce:%d",
+		permitDomain, ctx.GetStub().GetChannelID(), chaincode, owner, spender, value, deadline, nonce), nil
+}
+
+// chaincodeName returns the name the contract is deployed under, from the chaincode header of the signed proposal
+func chaincodeName(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	signedProposal, err := ctx.GetStub().GetSignedProposal()
+	if err != nil {
+		return "", fmt.Errorf("failed to get signed proposal: %v", err)
+	}
+
+	proposal := &peer.Proposal{}
+	err = proto.Unmarshal(signedProposal.GetProposalBytes(), proposal)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal proposal: %v", err)
+	}
+	header := &common.Header{}
+	err = proto.Unmarshal(proposal.GetHeader(), header)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal proposal header: %v", err)
+	}
+	channelHeader := &common.ChannelHeader{}
+	err = proto.Unmarshal(header.GetChannelHeader(), channelHeader)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal channel header: %v", err)
+	}
+	extension := &peer.ChaincodeHeaderExtension{}
+	err = proto.Unmarshal(channelHeader.GetExtension(), extension)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal chaincode header extension: %v", err)
+	}
+
+	return extension.GetChaincodeId().GetName(), nil
+}
+
+// recordClientKey stores the ECDSA public key of the submitting client's certificate as its permit key, the first time it
+// submits a transaction and again when the key changes, for example after the certificate was renewed
+// The peer validated the certificate against the client's MSP, so the key can be trusted. Other key types are skipped
+func recordClientKey(ctx contractapi.TransactionContextInterface) error {
+
+	owner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	certificate, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return fmt.Errorf("failed to get client certificate: %v", err)
+	}
+	if certificate == nil {
+		return nil
+	}
+	if _, ok := certificate.PublicKey.(*ecdsa.PublicKey); !ok {
+		return nil
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(certificate.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %v", err)
+	}
+
+	currentBytes, err := permitKeyHelper(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(currentBytes, publicKeyBytes) {
+		return nil
+	}
+
+	err = putNamespacedState(ctx, permitKeyPrefix, owner, encodeScalar(base64.StdEncoding.EncodeToString(publicKeyBytes)))
+	if err != nil {
+		return fmt.Errorf("failed to put permit key of %s in the world state: %v", owner, err)
+	}
+
+	log.Printf("client %s recorded its permit key", owner)
+
+	return nil
+}
+
+// permitNonceHelper reads the permit nonce of the owner, 0 when the owner never used a permit
+func permitNonceHelper(ctx contractapi.TransactionContextInterface, owner string) (int, error) {
+
+	nonceBytes, err := getNamespacedState(ctx, permitNoncePrefix, owner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read permit nonce of %s from world state: %v", owner, err)
+	}
+	if nonceBytes == nil {
+		return 0, nil
+	}
+
+	nonce, _ := strconv.Atoi(decodeScalar(nonceBytes)) // Error handling not needed since Itoa() was used when setting the nonce, guaranteeing it was an integer.
+
+	return nonce, nil
+}
+
+// permitKeyHelper returns the DER encoded permit key of the owner, nil when none was recorded
+// Keys recorded before schema version 2 are stored as bare DER bytes
+func permitKeyHelper(ctx contractapi.TransactionContextInterface, owner string) ([]byte, error) {
+
+	keyBytes, err := getNamespacedState(ctx, permitKeyPrefix, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permit key of %s from world state: %v", owner, err)
+	}
+	encodedKey := decodeScalar(keyBytes)
+	if encodedKey == string(keyBytes) {
+		return keyBytes, nil
+	}
+
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode permit key of %s: %v", owner, err)
+	}
+
+	return publicKeyBytes, nil
+}
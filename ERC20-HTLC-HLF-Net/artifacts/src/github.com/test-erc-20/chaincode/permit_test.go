@@ -0,0 +1,110 @@
+package chaincode_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+// signPermit signs the permit message with the owner's private key
+func signPermit(t *testing.T, key *ecdsa.PrivateKey, message string) string {
+	digest := sha256.Sum256([]byte(message))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestPermit(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bondx := newContext(stub, bondxID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	aliceKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	alice := &mocks.TransactionContext{
+		Stub:           stub,
+		ClientIdentity: &mocks.ClientIdentity{ID: aliceID, MSPID: "Org2MSP", Certificate: &x509.Certificate{PublicKey: &aliceKey.PublicKey}},
+	}
+
+	deadline := stub.TxTimestamp.AsTime().Add(time.Hour).Format(time.RFC3339)
+
+	message, err := contract.PermitMessage(bondx, aliceID, bondxID, "25", deadline, 0)
+	require.NoError(t, err)
+	signature := signPermit(t, aliceKey, message)
+
+	err = submit(stub, func() error { return contract.Permit(bondx, aliceID, bondxID, "25", deadline, 0, signature) })
+	require.EqualError(t, err, "owner "+aliceID+" has no permit key, it is recorded by the first transaction of the owner")
+
+	// Any transaction of the owner records its key
+	require.NoError(t, submit(stub, func() error { return contract.Approve(alice, malloryID, "1") }))
+
+	// The relayer can not change the signed terms
+	err = submit(stub, func() error { return contract.Permit(bondx, aliceID, bondxID, "50", deadline, 0, signature) })
+	require.EqualError(t, err, "invalid permit signature")
+
+	require.NoError(t, submit(stub, func() error { return contract.Permit(bondx, aliceID, bondxID, "25", deadline, 0, signature) }))
+	require.Equal(t, "Approval", stub.Event.Name)
+
+	allowance, err := contract.Allowance(bondx, aliceID, bondxID)
+	require.NoError(t, err)
+	require.Equal(t, "25", allowance)
+
+	nonce, err := contract.Nonces(bondx, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, 1, nonce)
+
+	// A permit can only be used once
+	err = submit(stub, func() error { return contract.Permit(bondx, aliceID, bondxID, "25", deadline, 0, signature) })
+	require.EqualError(t, err, "invalid permit nonce 0, expected 1")
+
+	expired := stub.TxTimestamp.AsTime().Add(-time.Minute).Format(time.RFC3339)
+	message, err = contract.PermitMessage(bondx, aliceID, bondxID, "25", expired, 1)
+	require.NoError(t, err)
+	err = submit(stub, func() error {
+		return contract.Permit(bondx, aliceID, bondxID, "25", expired, 1, signPermit(t, aliceKey, message))
+	})
+	require.ErrorContains(t, err, "permit expired at")
+}
+
+func TestPermitReplayOnAnotherDeployment(t *testing.T) {
+	// Two deployments of the contract on the same channel, each with its own nonces
+	stubA := mocks.NewChaincodeStub()
+	stubB := mocks.NewChaincodeStub()
+	stubB.ChaincodeName = "test-erc20-cc-2"
+	contract := chaincode.SmartContract{}
+	bondxA := newContext(stubA, bondxID, "Org1MSP")
+	bondxB := newContext(stubB, bondxID, "Org1MSP")
+
+	aliceKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	aliceIdentity := &mocks.ClientIdentity{ID: aliceID, MSPID: "Org2MSP", Certificate: &x509.Certificate{PublicKey: &aliceKey.PublicKey}}
+	aliceA := &mocks.TransactionContext{Stub: stubA, ClientIdentity: aliceIdentity}
+	aliceB := &mocks.TransactionContext{Stub: stubB, ClientIdentity: aliceIdentity}
+	require.NoError(t, submit(stubA, func() error { return contract.RegisterPermitKey(aliceA) }))
+	require.NoError(t, submit(stubB, func() error { return contract.RegisterPermitKey(aliceB) }))
+
+	deadline := stubA.TxTimestamp.AsTime().Add(time.Hour).Format(time.RFC3339)
+	message, err := contract.PermitMessage(bondxA, aliceID, bondxID, "25", deadline, 0)
+	require.NoError(t, err)
+	require.Contains(t, message, "chaincode:test-erc20-cc-1")
+	signature := signPermit(t, aliceKey, message)
+
+	require.NoError(t, submit(stubA, func() error { return contract.Permit(bondxA, aliceID, bondxID, "25", deadline, 0, signature) }))
+
+	// The nonce of the owner is still 0 on the second deployment, but the signature names the first one
+	err = submit(stubB, func() error { return contract.Permit(bondxB, aliceID, bondxID, "25", deadline, 0, signature) })
+	require.EqualError(t, err, "invalid permit signature")
+
+	allowance, err := contract.Allowance(bondxB, aliceID, bondxID)
+	require.NoError(t, err)
+	require.Equal(t, "0", allowance)
+}
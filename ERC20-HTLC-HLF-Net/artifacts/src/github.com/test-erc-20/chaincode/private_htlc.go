@@ -0,0 +1,174 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define the private data collection holding HTLC terms, as declared in collections_config.json
+const htlcTermsCollection = "htlcTermsCollection"
+
+// Define the transient map key carrying the HTLC terms
+const htlcTermsTransientKey = "htlcTerms"
+
+// HTLCTerms are the terms of a HTLC kept off the public ledger
+// Salt is an optional random value that stops other organizations from guessing the terms from their public hash
+type HTLCTerms struct {
+	Recipient    string `json:"recipient"`
+	Amount       string `json:"amount"`
+	PreimageHint string `json:"preimageHint,omitempty"`
+	Salt         string `json:"salt,omitempty"`
+}
+
+// TransferConditionalPrivate creates a conditional transfer like TransferConditional, keeping the recipient and amount private
+// The terms are passed as HTLCTerms JSON in the transient map under the htlcTerms key and stored in the HTLC terms collection,
+// shared by Org1 and Org2. Only their SHA256 digest is stored on the public ledger, as the termsHash of the HTLC
+// The balances are public, so the amount still shows in the locked balance of the sender and in the balance of the recipient once claimed
+// This function triggers a HTLCLocked event without recipient and amount
+func (s *SmartContract) TransferConditionalPrivate(ctx contractapi.TransactionContextInterface, hashLock string, timeLock string, hashAlgorithm string) error {
+
+	// Any client can lock tokens from its own balance
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient map: %v", err)
+	}
+	termsBytes, ok := transientMap[htlcTermsTransientKey]
+	if !ok {
+		return fmt.Errorf("HTLC terms must be passed in the transient map under the %s key", htlcTermsTransientKey)
+	}
+
+	var terms HTLCTerms
+	err = json.Unmarshal(termsBytes, &terms)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal HTLC terms: %v", err)
+	}
+	if terms.Recipient == "" {
+		return fmt.Errorf("HTLC terms must include a recipient")
+	}
+
+	termsHash := sha256.Sum256(termsBytes)
+	htlc, err := transferConditionalHelper(ctx, clientID, terms.Recipient, terms.Amount, hashLock, timeLock, hashAlgorithm, hex.EncodeToString(termsHash[:]))
+	if err != nil {
+		return err
+	}
+
+	// The terms are stored exactly as received, so that their hash matches GetPrivateDataHash on every peer
+	err = ctx.GetStub().PutPrivateData(htlcTermsCollection, htlc.HashLock, termsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put HTLC terms in the private data collection: %v", err)
+	}
+
+	return emitHTLCEvent(ctx, htlcLockedEvent, htlc)
+}
+
+// GetHTLCTerms returns the private terms of a HTLC
+// Only the sender and the recipient of the HTLC can read them, from a peer of the HTLC terms collection
+func (s *SmartContract) GetHTLCTerms(ctx contractapi.TransactionContextInterface, hashLock string) (*HTLCTerms, error) {
+
+	htlc, err := htlcHelper(ctx, hashLock)
+	if err != nil {
+		return nil, err
+	}
+	if htlc.TermsHash == "" {
+		return nil, fmt.Errorf("HTLC %s has public terms", htlc.HashLock)
+	}
+
+	terms, err := readHTLCTerms(ctx, htlc)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != htlc.Sender && clientID != terms.Recipient {
+		return nil, fmt.Errorf("client is not authorized to read the terms of HTLC %s", htlc.HashLock)
+	}
+
+	return terms, nil
+}
+
+// loadHTLCTerms fills in the recipient and amount of a HTLC with private terms
+// Dependant functions include claimHelper and revertHelper, which need them to release the escrow
+func loadHTLCTerms(ctx contractapi.TransactionContextInterface, htlc *HTLC) error {
+
+	if htlc.TermsHash == "" {
+		return nil
+	}
+
+	terms, err := readHTLCTerms(ctx, htlc)
+	if err != nil {
+		return err
+	}
+
+	amount, err := parseAmount(terms.Amount)
+	if err != nil {
+		return err
+	}
+	htlc.Recipient = terms.Recipient
+	htlc.Amount = amount.String()
+
+	return nil
+}
+
+// readHTLCTerms reads the private terms of a HTLC and checks them against its public terms hash
+func readHTLCTerms(ctx contractapi.TransactionContextInterface, htlc *HTLC) (*HTLCTerms, error) {
+
+	termsBytes, err := ctx.GetStub().GetPrivateData(htlcTermsCollection, htlc.HashLock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTLC terms from the private data collection: %v", err)
+	}
+	if termsBytes == nil {
+		return nil, fmt.Errorf("private terms of HTLC %s are not available on this peer", htlc.HashLock)
+	}
+
+	termsHash := sha256.Sum256(termsBytes)
+	if hex.EncodeToString(termsHash[:]) != htlc.TermsHash {
+		return nil, fmt.Errorf("private terms of HTLC %s do not match its terms hash", htlc.HashLock)
+	}
+
+	var terms HTLCTerms
+	err = json.Unmarshal(termsBytes, &terms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal HTLC terms: %v", err)
+	}
+
+	return &terms, nil
+}
+
+// publicHTLC returns the HTLC as it may appear on the public ledger, in events and in transaction results
+// For HTLCs with private terms it is a copy without recipient, amount and the fee derived from it
+func publicHTLC(htlc *HTLC) *HTLC {
+
+	if htlc.TermsHash == "" {
+		return htlc
+	}
+
+	public := *htlc
+	public.Recipient = ""
+	public.Amount = ""
+	public.Fee = ""
+
+	return &public
+}
+
+// historyAmount returns the amount to record in the public history of the HTLC, nil for HTLCs with private terms
+func historyAmount(htlc *HTLC, amount *big.Int) *big.Int {
+
+	if htlc.TermsHash != "" {
+		return nil
+	}
+
+	return amount
+}
@@ -0,0 +1,117 @@
+package chaincode_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPrivateHTLCClaim(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	mallory := newContext(stub, malloryID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	err := submit(stub, func() error { return contract.TransferConditionalPrivate(bank, secretHashLock, "1h", "") })
+	require.EqualError(t, err, "HTLC terms must be passed in the transient map under the htlcTerms key")
+
+	terms := []byte(`{"recipient":"` + aliceID + `","amount":"30","preimageHint":"invoice 42","salt":"c2FsdA=="}`)
+	stub.Transient["htlcTerms"] = terms
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditionalPrivate(bank, secretHashLock, "1h", "") }))
+
+	// Neither the event nor the public HTLC reveal the recipient or the amount
+	termsHash := sha256.Sum256(terms)
+	require.Equal(t, "HTLCLocked", stub.Event.Name)
+	var lockedEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &lockedEvent))
+	require.Equal(t, "", lockedEvent["recipient"])
+	require.Equal(t, "", lockedEvent["amount"])
+	require.Equal(t, hex.EncodeToString(termsHash[:]), lockedEvent["termsHash"])
+
+	htlc, err := contract.GetHashTimeLock(mallory, secretHashLock)
+	require.NoError(t, err)
+	require.Equal(t, "", htlc.Recipient)
+	require.Equal(t, "", htlc.Amount)
+	require.Equal(t, hex.EncodeToString(termsHash[:]), htlc.TermsHash)
+	for key, value := range stub.State {
+		require.NotContains(t, key, aliceID)
+		require.NotContains(t, string(value), aliceID)
+	}
+
+	// Neither the escrow account nor the history of the sender record the amount
+	escrowKey, err := stub.CreateCompositeKey("htlcEscrow", []string{secretHashLock})
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(termsHash[:]), mocks.ReadableValue(stub.State[escrowKey]))
+	history, err := contract.GetAccountHistory(bank, bankID, 10, "")
+	require.NoError(t, err)
+	var lockRecords int
+	for _, record := range history.Records {
+		if record.Type == "HTLC_LOCK" {
+			require.Equal(t, "", record.Amount)
+			lockRecords++
+		}
+	}
+	require.Equal(t, 1, lockRecords)
+
+	// The private data hash lets any peer check the terms against the public ledger
+	privateHash, err := stub.GetPrivateDataHash("htlcTermsCollection", secretHashLock)
+	require.NoError(t, err)
+	require.Equal(t, termsHash[:], privateHash)
+
+	readTerms, err := contract.GetHTLCTerms(alice, secretHashLock)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.HTLCTerms{Recipient: aliceID, Amount: "30", PreimageHint: "invoice 42", Salt: "c2FsdA=="}, readTerms)
+	_, err = contract.GetHTLCTerms(mallory, secretHashLock)
+	require.EqualError(t, err, "client is not authorized to read the terms of HTLC "+secretHashLock)
+
+	require.NoError(t, submit(stub, func() error { return contract.Claim(mallory, secretHashLock, "secret") }))
+	var claimedEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &claimedEvent))
+	require.Equal(t, "CLAIMED", claimedEvent["state"])
+	require.Equal(t, "", claimedEvent["recipient"])
+
+	aliceBalance, err := contract.BalanceOf(alice, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "30", aliceBalance.Available)
+
+	page, err := contract.ListHTLCsByRecipient(alice, aliceID, 10, "")
+	require.NoError(t, err)
+	require.Empty(t, page.Records)
+}
+
+func TestPrivateHTLCRevert(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	stub.Transient["htlcTerms"] = []byte(`{"recipient":"` + aliceID + `","amount":"30"}`)
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditionalPrivate(bank, secretHashLock, "1h", "") }))
+
+	// Tampered private terms are rejected
+	stub.PrivateData["htlcTermsCollection"][secretHashLock] = []byte(`{"recipient":"` + malloryID + `","amount":"30"}`)
+	stub.TxTimestamp = timestamppb.New(stub.TxTimestamp.AsTime().Add(2 * time.Hour))
+	err := submit(stub, func() error { return contract.Revert(bank, secretHashLock) })
+	require.EqualError(t, err, "private terms of HTLC "+secretHashLock+" do not match its terms hash")
+
+	stub.PrivateData["htlcTermsCollection"][secretHashLock] = stub.Transient["htlcTerms"]
+	require.NoError(t, submit(stub, func() error { return contract.Revert(bank, secretHashLock) }))
+
+	bankBalance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "100", bankBalance.Available)
+	require.Equal(t, "0", bankBalance.Locked)
+}
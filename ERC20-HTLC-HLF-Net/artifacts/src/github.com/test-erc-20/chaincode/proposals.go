@@ -0,0 +1,474 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key name of the proposal policy, stored under the metadata object type
+const proposalPolicyKey = "proposalPolicy"
+
+// Define objectType name for mint and burn proposals
+const proposalPrefix = "proposal"
+
+// Define the types of proposals
+const proposalMint = "MINT"
+const proposalBurn = "BURN"
+
+// Define the states of a proposal, EXPIRED is reported for pending proposals past their expiry but never stored
+const proposalStatePending = "PENDING"
+const proposalStateExecuted = "EXECUTED"
+const proposalStateCancelled = "CANCELLED"
+const proposalStateExpired = "EXPIRED"
+
+// Default policy used until an admin sets one, it requires no proposals
+const defaultProposalApprovals = 2
+const defaultProposalExpiry = 24 * time.Hour
+
+// ProposalPolicy configures which mints and burns need approval
+// Mints and burns above Threshold must be proposed and approved by Approvals distinct approvers within Expiry
+type ProposalPolicy struct {
+	Threshold     string `json:"threshold"`
+	Approvals     int    `json:"approvals"`
+	Expiry        string `json:"expiry"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// Proposal is a pending mint or burn, executed once it has collected the required approvals
+// RoleGrant is the certificate attribute grant the proposer holds its minter or burner role by, empty for a grant to its client ID
+type Proposal struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	Proposer      string    `json:"proposer"`
+	RoleGrant     string    `json:"roleGrant,omitempty"`
+	Amount        string    `json:"amount"`
+	Required      int       `json:"required"`
+	Approvals     []string  `json:"approvals"`
+	Expiry        time.Time `json:"expiry"`
+	State         string    `json:"state"`
+	SchemaVersion int       `json:"schemaVersion"`
+}
+
+// ProposalPage is a page of proposals, ordered by ID
+// Pass the bookmark to the next call to fetch the following page, an empty bookmark means there are no more results
+type ProposalPage struct {
+	Records             []*Proposal `json:"records"`
+	FetchedRecordsCount int32       `json:"fetchedRecordsCount"`
+	Bookmark            string      `json:"bookmark"`
+}
+
+// SetProposalPolicy sets the amount above which mints and burns need approval, the number of approvals and how long a proposal stays open
+// A threshold of 0 lets Mint and Burn move any amount directly, proposals can still be used
+// Only clients with the admin role can set the policy. This function triggers a ProposalPolicyChanged event
+func (s *SmartContract) SetProposalPolicy(ctx contractapi.TransactionContextInterface, threshold string, approvals int, expiry string) error {
+
+	// Check admin authorization
+	admin, err := requireRole(ctx, adminRole, "client is not authorized to change the proposal policy")
+	if err != nil {
+		return err
+	}
+
+	thresholdAmount, err := parseAmount(threshold)
+	if err != nil {
+		return err
+	}
+	if thresholdAmount.Sign() < 0 {
+		return fmt.Errorf("approval threshold cannot be negative")
+	}
+	if approvals < 1 {
+		return fmt.Errorf("a proposal needs at least one approval")
+	}
+	expiryDuration, err := time.ParseDuration(expiry)
+	if err != nil || expiryDuration <= 0 {
+		return fmt.Errorf("proposal expiry %s must be a positive duration such as 24h", expiry)
+	}
+
+	policy := ProposalPolicy{Threshold: thresholdAmount.String(), Approvals: approvals, Expiry: expiryDuration.String(), SchemaVersion: schemaVersion}
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = putNamespacedState(ctx, metadataPrefix, proposalPolicyKey, policyJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update proposal policy: %v", err)
+	}
+
+	log.Printf("proposal policy set to threshold %s, %d approvals, expiry %s by %s", policy.Threshold, policy.Approvals, policy.Expiry, admin)
+
+	err = ctx.GetStub().SetEvent("ProposalPolicyChanged", policyJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// GetProposalPolicy returns the current proposal policy
+func (s *SmartContract) GetProposalPolicy(ctx contractapi.TransactionContextInterface) (*ProposalPolicy, error) {
+
+	return proposalPolicyHelper(ctx)
+}
+
+// ProposeMint creates a proposal to mint tokens to the proposer's account balance
+// Only clients with the minter role can propose mints
+// This function triggers a ProposalCreated event
+func (s *SmartContract) ProposeMint(ctx contractapi.TransactionContextInterface, amount string) (*Proposal, error) {
+
+	// Check minter authorization
+	minter, grant, err := clientRoleGrant(ctx, minterRole, "client is not authorized to mint new tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	return createProposal(ctx, proposalMint, minter, grant, amount)
+}
+
+// ProposeBurn creates a proposal to burn tokens from the proposer's account balance
+// Only clients with the burner role can propose burns
+// This function triggers a ProposalCreated event
+func (s *SmartContract) ProposeBurn(ctx contractapi.TransactionContextInterface, amount string) (*Proposal, error) {
+
+	// Check burner authorization
+	burner, grant, err := clientRoleGrant(ctx, burnerRole, "client is not authorized to burn tokens")
+	if err != nil {
+		return nil, err
+	}
+
+	return createProposal(ctx, proposalBurn, burner, grant, amount)
+}
+
+// ApproveProposal adds the approval of the calling client to a pending proposal
+// Once the proposal has the required approvals it is executed in the same transaction
+// Only clients with the approver role can approve, and the proposer can not approve its own proposal
+// This function triggers a ProposalApproved event, or the Transfer event of the mint or burn when the proposal is executed
+func (s *SmartContract) ApproveProposal(ctx contractapi.TransactionContextInterface, id string) (*Proposal, error) {
+
+	// Check approver authorization
+	approver, err := requireRole(ctx, approverRole, "client is not authorized to approve proposals")
+	if err != nil {
+		return nil, err
+	}
+
+	proposal, err := readProposal(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = checkProposalPending(ctx, proposal)
+	if err != nil {
+		return nil, err
+	}
+
+	if approver == proposal.Proposer {
+		return nil, fmt.Errorf("proposer cannot approve its own proposal")
+	}
+	for _, existing := range proposal.Approvals {
+		if existing == approver {
+			return nil, fmt.Errorf("client already approved proposal %s", id)
+		}
+	}
+	proposal.Approvals = append(proposal.Approvals, approver)
+
+	if len(proposal.Approvals) < proposal.Required {
+		err = putProposal(ctx, proposal)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("proposal %s approved by %s, %d of %d approvals", id, approver, len(proposal.Approvals), proposal.Required)
+
+		return proposal, emitProposalEvent(ctx, "ProposalApproved", proposal)
+	}
+
+	// The proposer must still hold its role, a minter or burner revoked since proposing can not be paid
+	role := minterRole
+	if proposal.Type == proposalBurn {
+		role = burnerRole
+	}
+	granted, err := hasRoleGrant(ctx, role, proposal.Proposer, proposal.RoleGrant)
+	if err != nil {
+		return nil, err
+	}
+	if !granted {
+		return nil, fmt.Errorf("failed to execute proposal %s: proposer %s no longer has the %s role", id, proposal.Proposer, role)
+	}
+
+	// Execution reuses the Mint and Burn logic, so the supply limits and pause checks still apply
+	amount := parseStoredAmount([]byte(proposal.Amount))
+	if proposal.Type == proposalMint {
+		err = mintHelper(ctx, proposal.Proposer, amount)
+	} else {
+		err = burnHelper(ctx, proposal.Proposer, amount)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute proposal %s: %v", id, err)
+	}
+
+	proposal.State = proposalStateExecuted
+	err = putProposal(ctx, proposal)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("proposal %s executed after approval by %s", id, approver)
+
+	return proposal, nil
+}
+
+// CancelProposal cancels a pending proposal
+// Only the proposer or a client with the admin role can cancel a proposal
+// This function triggers a ProposalCancelled event
+func (s *SmartContract) CancelProposal(ctx contractapi.TransactionContextInterface, id string) error {
+
+	proposal, err := readProposal(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != proposal.Proposer {
+		_, err = requireRole(ctx, adminRole, fmt.Sprintf("client is not authorized to cancel proposal %s", id))
+		if err != nil {
+			return err
+		}
+	}
+
+	if proposal.State != proposalStatePending {
+		return fmt.Errorf("proposal %s is %s", id, proposal.State)
+	}
+
+	proposal.State = proposalStateCancelled
+	err = putProposal(ctx, proposal)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("proposal %s cancelled by %s", id, clientID)
+
+	return emitProposalEvent(ctx, "ProposalCancelled", proposal)
+}
+
+// GetProposal returns a proposal, pending proposals past their expiry are reported as EXPIRED
+func (s *SmartContract) GetProposal(ctx contractapi.TransactionContextInterface, id string) (*Proposal, error) {
+
+	proposal, err := readProposal(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return proposal, reportExpiry(ctx, proposal)
+}
+
+// ListProposals returns a page of all proposals, pending proposals past their expiry are reported as EXPIRED
+func (s *SmartContract) ListProposals(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*ProposalPage, error) {
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(proposalPrefix, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query proposals: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	page := &ProposalPage{Records: []*Proposal{}, FetchedRecordsCount: responseMetadata.GetFetchedRecordsCount(), Bookmark: responseMetadata.GetBookmark()}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read proposals: %v", err)
+		}
+
+		var proposal Proposal
+		err = json.Unmarshal(queryResponse.Value, &proposal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal proposal: %v", err)
+		}
+		err = reportExpiry(ctx, &proposal)
+		if err != nil {
+			return nil, err
+		}
+		page.Records = append(page.Records, &proposal)
+	}
+
+	return page, nil
+}
+
+// checkApprovalThreshold returns an error when the amount is above the approval threshold and must be proposed
+func checkApprovalThreshold(ctx contractapi.TransactionContextInterface, amount *big.Int) error {
+
+	policy, err := proposalPolicyHelper(ctx)
+	if err != nil {
+		return err
+	}
+
+	threshold := parseStoredAmount([]byte(policy.Threshold))
+	if threshold.Sign() > 0 && amount.Cmp(threshold) > 0 {
+		return fmt.Errorf("amount %s is above the approval threshold of %s, submit a proposal instead", amount, threshold)
+	}
+
+	return nil
+}
+
+// createProposal stores a new pending proposal, identified by the ID of the transaction creating it
+func createProposal(ctx contractapi.TransactionContextInterface, proposalType string, proposer string, roleGrant string, amount string) (*Proposal, error) {
+
+	proposalAmount, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+	if proposalAmount.Sign() <= 0 {
+		return nil, errors.New("proposal amount must be a positive integer")
+	}
+
+	policy, err := proposalPolicyHelper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expiry, _ := time.ParseDuration(policy.Expiry) // Error handling not needed since SetProposalPolicy validated the duration
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal := &Proposal{
+		ID:        ctx.GetStub().GetTxID(),
+		Type:      proposalType,
+		Proposer:  proposer,
+		RoleGrant: roleGrant,
+		Amount:    proposalAmount.String(),
+		Required:  policy.Approvals,
+		Approvals: []string{},
+		Expiry:    now.Add(expiry),
+		State:     proposalStatePending,
+	}
+
+	existing, err := getNamespacedState(ctx, proposalPrefix, proposal.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proposal %s from world state: %v", proposal.ID, err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("proposal %s already exists", proposal.ID)
+	}
+
+	err = putProposal(ctx, proposal)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("proposal %s to %s %s created by %s", proposal.ID, proposalType, proposal.Amount, proposer)
+
+	return proposal, emitProposalEvent(ctx, "ProposalCreated", proposal)
+}
+
+// checkProposalPending returns an error when the proposal can no longer be approved
+func checkProposalPending(ctx contractapi.TransactionContextInterface, proposal *Proposal) error {
+
+	if proposal.State != proposalStatePending {
+		return fmt.Errorf("proposal %s is %s", proposal.ID, proposal.State)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if now.After(proposal.Expiry) {
+		return fmt.Errorf("proposal %s expired at %s", proposal.ID, proposal.Expiry.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// reportExpiry sets the state of a pending proposal past its expiry to EXPIRED, without storing it
+func reportExpiry(ctx contractapi.TransactionContextInterface, proposal *Proposal) error {
+
+	if proposal.State != proposalStatePending {
+		return nil
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if now.After(proposal.Expiry) {
+		proposal.State = proposalStateExpired
+	}
+
+	return nil
+}
+
+// proposalPolicyHelper reads the proposal policy from the world state, falling back to the default policy
+func proposalPolicyHelper(ctx contractapi.TransactionContextInterface) (*ProposalPolicy, error) {
+
+	policyBytes, err := getNamespacedState(ctx, metadataPrefix, proposalPolicyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proposal policy from world state: %v", err)
+	}
+	if policyBytes == nil {
+		return &ProposalPolicy{Threshold: "0", Approvals: defaultProposalApprovals, Expiry: defaultProposalExpiry.String()}, nil
+	}
+
+	var policy ProposalPolicy
+	err = json.Unmarshal(policyBytes, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal proposal policy: %v", err)
+	}
+
+	return &policy, nil
+}
+
+// readProposal reads a proposal from the world state
+func readProposal(ctx contractapi.TransactionContextInterface, id string) (*Proposal, error) {
+
+	proposalBytes, err := getNamespacedState(ctx, proposalPrefix, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proposal %s from world state: %v", id, err)
+	}
+	if proposalBytes == nil {
+		return nil, fmt.Errorf("proposal %s does not exist", id)
+	}
+
+	var proposal Proposal
+	err = json.Unmarshal(proposalBytes, &proposal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal proposal %s: %v", id, err)
+	}
+
+	return &proposal, nil
+}
+
+// putProposal writes a proposal to the world state
+func putProposal(ctx contractapi.TransactionContextInterface, proposal *Proposal) error {
+
+	proposal.SchemaVersion = schemaVersion
+	proposalJSON, err := json.Marshal(proposal)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = putNamespacedState(ctx, proposalPrefix, proposal.ID, proposalJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put proposal %s: %v", proposal.ID, err)
+	}
+
+	return nil
+}
+
+// emitProposalEvent emits the named proposal event with the proposal as payload
+func emitProposalEvent(ctx contractapi.TransactionContextInterface, name string, proposal *Proposal) error {
+
+	proposalJSON, err := json.Marshal(proposal)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, proposalJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMintProposal(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	bondx := newContext(stub, bondxID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	mallory := newContext(stub, malloryID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "approver", bankID) }))
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "approver", bondxID) }))
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "approver", aliceID) }))
+
+	err := submit(stub, func() error { return contract.SetProposalPolicy(alice, "1000", 2, "1h") })
+	require.EqualError(t, err, "client is not authorized to change the proposal policy")
+	err = submit(stub, func() error { return contract.SetProposalPolicy(bank, "1000", 0, "1h") })
+	require.EqualError(t, err, "a proposal needs at least one approval")
+	require.NoError(t, submit(stub, func() error { return contract.SetProposalPolicy(bank, "1000", 2, "1h") }))
+	require.Equal(t, "ProposalPolicyChanged", stub.Event.Name)
+
+	// Amounts up to the threshold can still be minted directly
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "1000") }))
+	err = submit(stub, func() error { return contract.Mint(bank, "1001") })
+	require.EqualError(t, err, "failed to mint: amount 1001 is above the approval threshold of 1000, submit a proposal instead")
+
+	err = submit(stub, func() error { _, err := contract.ProposeMint(alice, "5000"); return err })
+	require.EqualError(t, err, "client is not authorized to mint new tokens")
+
+	nextTx(stub)
+	var proposal *chaincode.Proposal
+	err = submit(stub, func() error {
+		var err error
+		proposal, err = contract.ProposeMint(bank, "5000")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ProposalCreated", stub.Event.Name)
+	require.Equal(t, stub.TxID, proposal.ID)
+	require.Equal(t, "PENDING", proposal.State)
+	require.Equal(t, 2, proposal.Required)
+
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(mallory, proposal.ID); return err })
+	require.EqualError(t, err, "client is not authorized to approve proposals")
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(bank, proposal.ID); return err })
+	require.EqualError(t, err, "proposer cannot approve its own proposal")
+
+	err = submit(stub, func() error {
+		var err error
+		proposal, err = contract.ApproveProposal(bondx, proposal.ID)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ProposalApproved", stub.Event.Name)
+	require.Equal(t, []string{bondxID}, proposal.Approvals)
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(bondx, proposal.ID); return err })
+	require.EqualError(t, err, "client already approved proposal "+proposal.ID)
+
+	// The second distinct approval executes the mint
+	err = submit(stub, func() error {
+		var err error
+		proposal, err = contract.ApproveProposal(alice, proposal.ID)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "EXECUTED", proposal.State)
+	require.Equal(t, "Transfer", stub.Event.Name)
+
+	balance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "6000", balance.Available)
+
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(alice, proposal.ID); return err })
+	require.EqualError(t, err, "proposal "+proposal.ID+" is EXECUTED")
+
+	// Burns above the threshold follow the same flow
+	nextTx(stub)
+	var burn *chaincode.Proposal
+	err = submit(stub, func() error {
+		var err error
+		burn, err = contract.ProposeBurn(bank, "2000")
+		return err
+	})
+	require.NoError(t, err)
+	err = submit(stub, func() error { return contract.Burn(bank, "2000") })
+	require.EqualError(t, err, "failed to burn: amount 2000 is above the approval threshold of 1000, submit a proposal instead")
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(alice, burn.ID); return err })
+	require.NoError(t, err)
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(bondx, burn.ID); return err })
+	require.NoError(t, err)
+
+	totalSupply, err := contract.TotalSupply(bank)
+	require.NoError(t, err)
+	require.Equal(t, "4000", totalSupply)
+
+	page, err := contract.ListProposals(alice, 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 2)
+}
+
+func TestProposalExpiryAndCancel(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	bondx := newContext(stub, bondxID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "minter", bondxID) }))
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "approver", aliceID) }))
+	require.NoError(t, submit(stub, func() error { return contract.SetProposalPolicy(bank, "100", 1, "1h") }))
+
+	nextTx(stub)
+	var expiring *chaincode.Proposal
+	err := submit(stub, func() error {
+		var err error
+		expiring, err = contract.ProposeMint(bank, "500")
+		return err
+	})
+	require.NoError(t, err)
+
+	nextTx(stub)
+	var cancelled *chaincode.Proposal
+	err = submit(stub, func() error {
+		var err error
+		cancelled, err = contract.ProposeMint(bondx, "500")
+		return err
+	})
+	require.NoError(t, err)
+
+	// Only the proposer or an admin can cancel
+	err = submit(stub, func() error { return contract.CancelProposal(alice, cancelled.ID) })
+	require.EqualError(t, err, "client is not authorized to cancel proposal "+cancelled.ID)
+	require.NoError(t, submit(stub, func() error { return contract.CancelProposal(bondx, cancelled.ID) }))
+	require.Equal(t, "ProposalCancelled", stub.Event.Name)
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(alice, cancelled.ID); return err })
+	require.EqualError(t, err, "proposal "+cancelled.ID+" is CANCELLED")
+
+	stub.TxTimestamp = timestamppb.New(stub.TxTimestamp.AsTime().Add(2 * time.Hour))
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(alice, expiring.ID); return err })
+	require.EqualError(t, err, "proposal "+expiring.ID+" expired at "+expiring.Expiry.Format(time.RFC3339))
+
+	proposal, err := contract.GetProposal(alice, expiring.ID)
+	require.NoError(t, err)
+	require.Equal(t, "EXPIRED", proposal.State)
+
+	totalSupply, err := contract.TotalSupply(bank)
+	require.NoError(t, err)
+	require.Equal(t, "0", totalSupply)
+}
+
+func TestProposalOfRevokedProposer(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	bondx := newContext(stub, bondxID, "Org1MSP")
+	operator := &mocks.TransactionContext{
+		Stub:           stub,
+		ClientIdentity: &mocks.ClientIdentity{ID: malloryID, MSPID: "Org1MSP", Attributes: map[string]string{"treasury": "minter"}},
+	}
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "minter", bondxID) }))
+	require.NoError(t, submit(stub, func() error { return contract.GrantRoleToAttribute(bank, "minter", "treasury", "minter") }))
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "approver", aliceID) }))
+	require.NoError(t, submit(stub, func() error { return contract.SetProposalPolicy(bank, "100", 1, "1h") }))
+
+	nextTx(stub)
+	var proposal *chaincode.Proposal
+	err := submit(stub, func() error {
+		var err error
+		proposal, err = contract.ProposeMint(bondx, "500")
+		return err
+	})
+	require.NoError(t, err)
+
+	nextTx(stub)
+	var attributeProposal *chaincode.Proposal
+	err = submit(stub, func() error {
+		var err error
+		attributeProposal, err = contract.ProposeMint(operator, "500")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "attribute:treasury=minter", attributeProposal.RoleGrant)
+
+	// A minter revoked after proposing is not paid once the proposal is approved
+	require.NoError(t, submit(stub, func() error { return contract.RevokeRole(bank, "minter", bondxID) }))
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(alice, proposal.ID); return err })
+	require.EqualError(t, err, "failed to execute proposal "+proposal.ID+": proposer "+bondxID+" no longer has the minter role")
+
+	require.NoError(t, submit(stub, func() error { return contract.RevokeRoleFromAttribute(bank, "minter", "treasury", "minter") }))
+	err = submit(stub, func() error { _, err := contract.ApproveProposal(alice, attributeProposal.ID); return err })
+	require.EqualError(t, err, "failed to execute proposal "+attributeProposal.ID+": proposer "+malloryID+" no longer has the minter role")
+
+	totalSupply, err := contract.TotalSupply(bank)
+	require.NoError(t, err)
+	require.Equal(t, "0", totalSupply)
+}
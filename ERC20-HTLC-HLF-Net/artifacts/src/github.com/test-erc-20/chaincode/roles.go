@@ -0,0 +1,311 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define role names
+const adminRole = "admin"
+const minterRole = "minter"
+const burnerRole = "burner"
+const pauserRole = "pauser"
+const htlcOperatorRole = "htlcOperator"
+const approverRole = "approver"
+
+var knownRoles = []string{adminRole, minterRole, burnerRole, pauserRole, htlcOperatorRole, approverRole}
+
+// Define objectType names for role membership, granted to a client ID or to a certificate attribute value
+const roleMemberPrefix = "roleMember"
+const roleAttributePrefix = "roleAttribute"
+
+// Define the prefix of attribute grants in GetRoleMembers results
+const attributeMemberPrefix = "attribute:"
+
+// roleEvent is the payload of the RoleGranted and RoleRevoked events
+type roleEvent struct {
+	Role    string `json:"role"`
+	Account string `json:"account"`
+	Sender  string `json:"sender"`
+}
+
+// GrantRole grants the role to the account, identified by its client ID
+// Only clients with the admin role can grant roles
+// This function triggers a RoleGranted event
+func (s *SmartContract) GrantRole(ctx contractapi.TransactionContextInterface, role string, account string) error {
+
+	return setRoleMember(ctx, role, roleMemberPrefix, []string{role, account}, account, true)
+}
+
+// RevokeRole revokes the role from the account, identified by its client ID
+// Only clients with the admin role can revoke roles, and an admin can not revoke its own admin role
+// This function triggers a RoleRevoked event
+func (s *SmartContract) RevokeRole(ctx contractapi.TransactionContextInterface, role string, account string) error {
+
+	return setRoleMember(ctx, role, roleMemberPrefix, []string{role, account}, account, false)
+}
+
+// GrantRoleToAttribute grants the role to every client whose certificate has the attribute with the given value
+// Only clients with the admin role can grant roles
+// This function triggers a RoleGranted event
+func (s *SmartContract) GrantRoleToAttribute(ctx contractapi.TransactionContextInterface, role string, attributeName string, attributeValue string) error {
+
+	account := attributeMemberPrefix + attributeName + "=" + attributeValue
+	return setRoleMember(ctx, role, roleAttributePrefix, []string{role, attributeName, attributeValue}, account, true)
+}
+
+// RevokeRoleFromAttribute revokes a role granted to a certificate attribute value
+// Only clients with the admin role can revoke roles
+// This function triggers a RoleRevoked event
+func (s *SmartContract) RevokeRoleFromAttribute(ctx contractapi.TransactionContextInterface, role string, attributeName string, attributeValue string) error {
+
+	account := attributeMemberPrefix + attributeName + "=" + attributeValue
+	return setRoleMember(ctx, role, roleAttributePrefix, []string{role, attributeName, attributeValue}, account, false)
+}
+
+// HasRole returns whether the role was granted to the account, identified by its client ID
+// Roles granted to certificate attributes can only be checked for the calling client, when it submits a transaction
+func (s *SmartContract) HasRole(ctx contractapi.TransactionContextInterface, role string, account string) (bool, error) {
+
+	err := checkRoleName(role)
+	if err != nil {
+		return false, err
+	}
+
+	return hasRoleMember(ctx, role, account)
+}
+
+// GetRoleMembers returns the client IDs the role was granted to, followed by the certificate attributes
+// the role was granted to, in the form attribute:name=value
+func (s *SmartContract) GetRoleMembers(ctx contractapi.TransactionContextInterface, role string) ([]string, error) {
+
+	err := checkRoleName(role)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []string{}
+
+	memberIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(roleMemberPrefix, []string{role})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s members: %v", role, err)
+	}
+	defer memberIterator.Close()
+
+	for memberIterator.HasNext() {
+		queryResponse, err := memberIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s members: %v", role, err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split the composite key %s: %v", queryResponse.Key, err)
+		}
+		members = append(members, attributes[1])
+	}
+
+	attributeGrants, err := roleAttributeGrants(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range attributeGrants {
+		members = append(members, attributeMemberPrefix+grant[0]+"="+grant[1])
+	}
+
+	return members, nil
+}
+
+// requireRole checks that the calling client has the role, either by client ID or by certificate attribute
+// It returns the client ID of the caller
+func requireRole(ctx contractapi.TransactionContextInterface, role string, message string) (string, error) {
+
+	clientID, _, err := clientRoleGrant(ctx, role, message)
+
+	return clientID, err
+}
+
+// clientRoleGrant checks that the calling client has the role like requireRole, and also returns the grant it holds the role by:
+// empty for a grant to its client ID, attribute:name=value for a grant to a certificate attribute
+func clientRoleGrant(ctx contractapi.TransactionContextInterface, role string, message string) (string, string, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	granted, err := hasRoleMember(ctx, role, clientID)
+	if err != nil {
+		return "", "", err
+	}
+	if granted {
+		return clientID, "", nil
+	}
+
+	attributeGrants, err := roleAttributeGrants(ctx, role)
+	if err != nil {
+		return "", "", err
+	}
+	for _, grant := range attributeGrants {
+		value, found, err := ctx.GetClientIdentity().GetAttributeValue(grant[0])
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get attribute %s: %v", grant[0], err)
+		}
+		if found && value == grant[1] {
+			return clientID, attributeMemberPrefix + grant[0] + "=" + grant[1], nil
+		}
+	}
+
+	return "", "", errors.New(message)
+}
+
+// hasRoleGrant returns whether the grant returned by clientRoleGrant for the account still holds the role
+// Dependant functions include ApproveProposal, which checks the role of the proposer when executing its proposal
+func hasRoleGrant(ctx contractapi.TransactionContextInterface, role string, account string, grant string) (bool, error) {
+
+	if grant == "" {
+		return hasRoleMember(ctx, role, account)
+	}
+
+	attribute := strings.SplitN(strings.TrimPrefix(grant, attributeMemberPrefix), "=", 2)
+	if len(attribute) != 2 {
+		return false, fmt.Errorf("invalid role grant %s", grant)
+	}
+
+	grantKey, err := ctx.GetStub().CreateCompositeKey(roleAttributePrefix, []string{role, attribute[0], attribute[1]})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", roleAttributePrefix, err)
+	}
+
+	grantBytes, err := ctx.GetStub().GetState(grantKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s role grant %s from world state: %v", role, grant, err)
+	}
+
+	return grantBytes != nil, nil
+}
+
+// grantRoleHelper records the role membership of the account without checking the caller
+// Dependant functions include Initialize, which bootstraps the admin role
+func grantRoleHelper(ctx contractapi.TransactionContextInterface, role string, account string) error {
+
+	memberKey, err := ctx.GetStub().CreateCompositeKey(roleMemberPrefix, []string{role, account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", roleMemberPrefix, err)
+	}
+
+	return ctx.GetStub().PutState(memberKey, indexValue)
+}
+
+// setRoleMember grants or revokes the membership stored under the composite key of the objectType and attributes
+func setRoleMember(ctx contractapi.TransactionContextInterface, role string, objectType string, attributes []string, account string, granted bool) error {
+
+	// Check admin authorization
+	adminID, err := requireRole(ctx, adminRole, "client is not authorized to manage roles")
+	if err != nil {
+		return err
+	}
+
+	err = checkRoleName(role)
+	if err != nil {
+		return err
+	}
+
+	if account == "" || attributes[len(attributes)-1] == "" {
+		return fmt.Errorf("role member must not be empty")
+	}
+
+	if !granted && role == adminRole && account == adminID {
+		return fmt.Errorf("admin cannot revoke its own admin role")
+	}
+
+	memberKey, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", objectType, err)
+	}
+
+	eventName := "RoleGranted"
+	if granted {
+		err = ctx.GetStub().PutState(memberKey, indexValue)
+	} else {
+		eventName = "RoleRevoked"
+		err = ctx.GetStub().DelState(memberKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update %s role of %s: %v", role, account, err)
+	}
+
+	// Emit the RoleGranted or RoleRevoked event
+	membershipEvent := roleEvent{Role: role, Account: account, Sender: adminID}
+	membershipEventJSON, err := json.Marshal(membershipEvent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(eventName, membershipEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("%s role of %s updated by %s, granted: %t", role, account, adminID, granted)
+
+	return nil
+}
+
+// hasRoleMember returns whether the role was granted to the client ID
+func hasRoleMember(ctx contractapi.TransactionContextInterface, role string, account string) (bool, error) {
+
+	memberKey, err := ctx.GetStub().CreateCompositeKey(roleMemberPrefix, []string{role, account})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", roleMemberPrefix, err)
+	}
+
+	memberBytes, err := ctx.GetStub().GetState(memberKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s role of %s from world state: %v", role, account, err)
+	}
+
+	return memberBytes != nil, nil
+}
+
+// roleAttributeGrants returns the attribute name and value pairs the role was granted to
+func roleAttributeGrants(ctx contractapi.TransactionContextInterface, role string) ([][2]string, error) {
+
+	grantIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(roleAttributePrefix, []string{role})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s attribute grants: %v", role, err)
+	}
+	defer grantIterator.Close()
+
+	var grants [][2]string
+	for grantIterator.HasNext() {
+		queryResponse, err := grantIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s attribute grants: %v", role, err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split the composite key %s: %v", queryResponse.Key, err)
+		}
+		grants = append(grants, [2]string{attributes[1], attributes[2]})
+	}
+
+	return grants, nil
+}
+
+// checkRoleName validates the role against the roles known to the contract
+func checkRoleName(role string) error {
+
+	for _, knownRole := range knownRoles {
+		if role == knownRole {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown role %s, expected one of %s", role, strings.Join(knownRoles, ", "))
+}
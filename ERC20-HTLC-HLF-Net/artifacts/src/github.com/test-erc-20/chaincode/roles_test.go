@@ -0,0 +1,88 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+func TestRoles(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	bondx := newContext(stub, bondxID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	require.NoError(t, submit(stub, func() error { return contract.Initialize(bank, "erc20", "BETH", 0) }))
+
+	// Being in Org1 is no longer enough to mint
+	err := submit(stub, func() error { return contract.Mint(bondx, "10") })
+	require.EqualError(t, err, "client is not authorized to mint new tokens")
+
+	err = submit(stub, func() error { return contract.GrantRole(bondx, "minter", bondxID) })
+	require.EqualError(t, err, "client is not authorized to manage roles")
+
+	err = submit(stub, func() error { return contract.GrantRole(bank, "owner", bondxID) })
+	require.EqualError(t, err, "unknown role owner, expected one of admin, minter, burner, pauser, htlcOperator, approver")
+
+	require.NoError(t, submit(stub, func() error { return contract.GrantRole(bank, "minter", bondxID) }))
+	require.Equal(t, "RoleGranted", stub.Event.Name)
+	var grantedEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &grantedEvent))
+	require.Equal(t, "minter", grantedEvent["role"])
+	require.Equal(t, bondxID, grantedEvent["account"])
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bondx, "10") }))
+
+	// Minting does not imply burning
+	err = submit(stub, func() error { return contract.Burn(bondx, "1") })
+	require.EqualError(t, err, "client is not authorized to burn tokens")
+
+	hasRole, err := contract.HasRole(bank, "minter", bondxID)
+	require.NoError(t, err)
+	require.True(t, hasRole)
+
+	members, err := contract.GetRoleMembers(bank, "admin")
+	require.NoError(t, err)
+	require.Equal(t, []string{bankID}, members)
+
+	require.NoError(t, submit(stub, func() error { return contract.RevokeRole(bank, "minter", bondxID) }))
+	require.Equal(t, "RoleRevoked", stub.Event.Name)
+
+	err = submit(stub, func() error { return contract.Mint(bondx, "10") })
+	require.EqualError(t, err, "client is not authorized to mint new tokens")
+
+	err = submit(stub, func() error { return contract.RevokeRole(bank, "admin", bankID) })
+	require.EqualError(t, err, "admin cannot revoke its own admin role")
+}
+
+func TestRoleGrantedToAttribute(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	operator := &mocks.TransactionContext{
+		Stub:           stub,
+		ClientIdentity: &mocks.ClientIdentity{ID: bondxID, MSPID: "Org1MSP", Attributes: map[string]string{"treasury": "minter"}},
+	}
+	contract := chaincode.SmartContract{}
+
+	require.NoError(t, submit(stub, func() error { return contract.Initialize(bank, "erc20", "BETH", 0) }))
+	require.NoError(t, submit(stub, func() error { return contract.GrantRoleToAttribute(bank, "minter", "treasury", "minter") }))
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(operator, "10") }))
+
+	members, err := contract.GetRoleMembers(bank, "minter")
+	require.NoError(t, err)
+	require.Equal(t, []string{"attribute:treasury=minter"}, members)
+
+	// HasRole only checks client IDs, attribute grants apply when the client submits a transaction
+	hasRole, err := contract.HasRole(bank, "minter", bondxID)
+	require.NoError(t, err)
+	require.False(t, hasRole)
+
+	require.NoError(t, submit(stub, func() error { return contract.RevokeRoleFromAttribute(bank, "minter", "treasury", "minter") }))
+
+	err = submit(stub, func() error { return contract.Mint(operator, "10") })
+	require.EqualError(t, err, "client is not authorized to mint new tokens")
+}
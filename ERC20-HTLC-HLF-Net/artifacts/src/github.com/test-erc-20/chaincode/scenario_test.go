@@ -0,0 +1,111 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+func TestScenario(t *testing.T) {
+	sc := mocks.NewScenario()
+	bank := sc.AdminIdentity(bankID, "Org1MSP")
+	bondx := sc.Identity(bondxID, "Org1MSP")
+	alice := sc.Identity(aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	result := sc.Submit(func() error { return contract.Initialize(bank, "erc20", "BETH", 0) })
+	require.NoError(t, result.Err)
+	require.Equal(t, "erc20", result.Changes["metadata~name"].After)
+	for _, role := range []string{"minter", "burner", "htlcOperator"} {
+		require.NoError(t, sc.Submit(func() error { return contract.GrantRole(bank, role, bankID) }).Err)
+	}
+
+	// Mint
+	result = sc.Submit(func() error { return contract.Mint(bank, "100") })
+	require.NoError(t, result.Err)
+	var transfer map[string]string
+	require.Equal(t, "Transfer", result.Event.Name)
+	require.NoError(t, result.Event.Decode(&transfer))
+	require.Equal(t, map[string]string{"from": "0x0", "to": bankID, "value": "100"}, transfer)
+	require.Equal(t, mocks.StateChange{After: "100"}, result.Changes["balance~"+bankID])
+	require.Equal(t, mocks.StateChange{After: "100"}, result.Changes["metadata~totalSupply"])
+
+	// Approve and TransferFrom
+	result = sc.Submit(func() error { return contract.Approve(bank, bondxID, "40") })
+	require.NoError(t, result.Err)
+	require.Equal(t, "Approval", result.Event.Name)
+	require.Equal(t, map[string]mocks.StateChange{"allowance~" + bankID + "~" + bondxID: {After: "40"}}, result.Changes)
+
+	result = sc.Submit(func() error { return contract.TransferFrom(bondx, bankID, aliceID, "25") })
+	require.NoError(t, result.Err)
+	require.NoError(t, result.Event.Decode(&transfer))
+	require.Equal(t, map[string]string{"from": bankID, "to": aliceID, "value": "25"}, transfer)
+	require.Equal(t, mocks.StateChange{Before: "40", After: "15"}, result.Changes["allowance~"+bankID+"~"+bondxID])
+	require.Equal(t, mocks.StateChange{Before: "100", After: "75"}, result.Changes["balance~"+bankID])
+	require.Equal(t, mocks.StateChange{After: "25"}, result.Changes["balance~"+aliceID])
+
+	// A failed transaction emits no event and leaves the world state untouched
+	result = sc.Submit(func() error { return contract.TransferFrom(bondx, bankID, aliceID, "16") })
+	require.Error(t, result.Err)
+	require.Nil(t, result.Event)
+	require.Empty(t, result.Changes)
+
+	// Lock and claim
+	result = sc.Submit(func() error { return contract.TransferConditional(bank, aliceID, "30", secretHashLock, "1h", "") })
+	require.NoError(t, result.Err)
+	require.Equal(t, "HTLCLocked", result.Event.Name)
+	require.Equal(t, mocks.StateChange{Before: "75", After: "45"}, result.Changes["balance~"+bankID])
+	require.Equal(t, mocks.StateChange{After: "30"}, result.Changes["htlcEscrow~"+secretHashLock])
+	require.Equal(t, mocks.StateChange{After: "30"}, result.Changes["lockedBalance~"+bankID])
+
+	result = sc.Submit(func() error { return contract.Claim(alice, secretHashLock, "secret") })
+	require.NoError(t, result.Err)
+	var claimed map[string]interface{}
+	require.Equal(t, "HTLCClaimed", result.Event.Name)
+	require.NoError(t, result.Event.Decode(&claimed))
+	require.Equal(t, secretPreimageHex, claimed["preimage"])
+	require.Equal(t, mocks.StateChange{Before: "25", After: "55"}, result.Changes["balance~"+aliceID])
+	require.Equal(t, mocks.StateChange{Before: "30", Deleted: true}, result.Changes["htlcEscrow~"+secretHashLock])
+	require.Equal(t, mocks.StateChange{Before: "30", Deleted: true}, result.Changes["lockedBalance~"+bankID])
+
+	// Lock and revert once the timelock has expired
+	otherHashLock := hashLockOf("other")
+	require.NoError(t, sc.Submit(func() error { return contract.TransferConditional(bank, aliceID, "5", otherHashLock, "1h", "") }).Err)
+
+	result = sc.Submit(func() error { return contract.Revert(bank, otherHashLock) })
+	require.EqualError(t, result.Err, "invalid Revert: timelock not yet expired")
+	require.Empty(t, result.Changes)
+
+	sc.Advance(time.Hour)
+	result = sc.Submit(func() error { return contract.Revert(bank, otherHashLock) })
+	require.NoError(t, result.Err)
+	require.Equal(t, "HTLCRefunded", result.Event.Name)
+	require.Equal(t, mocks.StateChange{Before: "40", After: "45"}, result.Changes["balance~"+bankID])
+
+	page, err := contract.GetAccountHistory(bank, bankID, 0, "")
+	require.NoError(t, err)
+	types := []string{}
+	for _, entry := range page.Records {
+		types = append(types, entry.Type)
+	}
+	require.Equal(t, []string{"MINT", "TRANSFER_OUT", "HTLC_LOCK", "HTLC_LOCK", "HTLC_REFUND"}, types)
+
+	// A transaction failing after some of its writes commits none of them
+	result = sc.Submit(func() error {
+		_, err := contract.TransferConditionalBatch(bank, []chaincode.TransferConditionalRequest{
+			{Recipient: aliceID, Amount: "5", HashLock: hashLockOf("first"), TimeLock: "1h"},
+			{Recipient: aliceID, Amount: "500", HashLock: hashLockOf("second"), TimeLock: "1h"},
+		})
+		return err
+	})
+	require.ErrorContains(t, result.Err, "failed to lock item 1")
+	require.Empty(t, result.Changes)
+	balance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.AccountBalance{Account: bankID, Available: "45", Locked: "0", OnHold: "0"}, balance)
+	_, err = contract.GetHashTimeLock(alice, hashLockOf("first"))
+	require.Error(t, err)
+}
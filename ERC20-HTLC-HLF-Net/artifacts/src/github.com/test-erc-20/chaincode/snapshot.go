@@ -0,0 +1,253 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key name of the ID of the latest snapshot, stored under the metadata object type
+const currentSnapshotKey = "currentSnapshot"
+
+// Define objectType names for the snapshots and the values checkpointed for them
+const (
+	snapshotPrefix           = "snapshot"
+	snapshotCheckpointPrefix = "snapshotCheckpoint"
+)
+
+// snapshotIDFormat pads snapshot IDs in composite keys, so that checkpoints of an account are listed in snapshot order
+const snapshotIDFormat = "%020d"
+
+// SnapshotInfo is a snapshot of the balances and total supply, taken at the timestamp of the Snapshot transaction
+type SnapshotInfo struct {
+	ID            int       `json:"id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Sender        string    `json:"sender"`
+	SchemaVersion int       `json:"schemaVersion"`
+}
+
+// Snapshot records a new snapshot of all balances and of the total supply, and returns its ID
+// Nothing is copied when the snapshot is taken: the first change of a balance or of the total supply after a snapshot
+// checkpoints its previous value, which BalanceOfAt and TotalSupplyAt then read
+// Only clients with the admin role can take snapshots. This function triggers a Snapshot event
+func (s *SmartContract) Snapshot(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	// Check admin authorization
+	admin, err := requireRole(ctx, adminRole, "client is not authorized to take snapshots")
+	if err != nil {
+		return 0, err
+	}
+
+	current, err := currentSnapshotID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	snapshot := SnapshotInfo{ID: current + 1, Timestamp: now, Sender: admin, SchemaVersion: schemaVersion}
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return 0, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = putNamespacedState(ctx, snapshotPrefix, fmt.Sprintf(snapshotIDFormat, snapshot.ID), snapshotJSON)
+	if err != nil {
+		return 0, fmt.Errorf("failed to put snapshot %d to world state: %v", snapshot.ID, err)
+	}
+	err = putNamespacedState(ctx, metadataPrefix, currentSnapshotKey, encodeScalar(strconv.Itoa(snapshot.ID)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update current snapshot: %v", err)
+	}
+
+	log.Printf("snapshot %d taken by %s", snapshot.ID, admin)
+
+	err = ctx.GetStub().SetEvent("Snapshot", snapshotJSON)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return snapshot.ID, nil
+}
+
+// GetSnapshot returns the snapshot with the given ID
+func (s *SmartContract) GetSnapshot(ctx contractapi.TransactionContextInterface, snapshotID int) (*SnapshotInfo, error) {
+
+	snapshotBytes, err := getNamespacedState(ctx, snapshotPrefix, fmt.Sprintf(snapshotIDFormat, snapshotID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %d from world state: %v", snapshotID, err)
+	}
+	if snapshotBytes == nil {
+		return nil, fmt.Errorf("snapshot %d does not exist", snapshotID)
+	}
+
+	var snapshot SnapshotInfo
+	err = json.Unmarshal(snapshotBytes, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %v", err)
+	}
+
+	return &snapshot, nil
+}
+
+// BalanceOfAt returns the available, locked and on hold balance of the account at the time of the snapshot
+// Unlike BalanceOf, an account without tokens at the time of the snapshot has a zero balance instead of an error
+func (s *SmartContract) BalanceOfAt(ctx contractapi.TransactionContextInterface, account string, snapshotID int) (*AccountBalance, error) {
+
+	_, err := s.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	available, err := valueAtSnapshot(ctx, balancePrefix, account, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := valueAtSnapshot(ctx, lockedBalancePrefix, account, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	onHold, err := valueAtSnapshot(ctx, holdBalancePrefix, account, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountBalance{Account: account, Available: available.String(), Locked: locked.String(), OnHold: onHold.String()}, nil
+}
+
+// TotalSupplyAt returns the total supply at the time of the snapshot
+func (s *SmartContract) TotalSupplyAt(ctx contractapi.TransactionContextInterface, snapshotID int) (string, error) {
+
+	_, err := s.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		return "", err
+	}
+
+	totalSupply, err := valueAtSnapshot(ctx, metadataPrefix, totalSupplyKey, snapshotID)
+	if err != nil {
+		return "", err
+	}
+
+	return totalSupply.String(), nil
+}
+
+// putBalance stores the balance of the account, after checkpointing its previous value for the current snapshot
+func putBalance(ctx contractapi.TransactionContextInterface, account string, balance *big.Int) error {
+
+	err := checkpointSnapshot(ctx, balancePrefix, account)
+	if err != nil {
+		return err
+	}
+
+	return putNamespacedState(ctx, balancePrefix, account, encodeScalar(balance.String()))
+}
+
+// putTotalSupply stores the total supply, after checkpointing its previous value for the current snapshot
+func putTotalSupply(ctx contractapi.TransactionContextInterface, totalSupply *big.Int) error {
+
+	err := checkpointSnapshot(ctx, metadataPrefix, totalSupplyKey)
+	if err != nil {
+		return err
+	}
+
+	return putNamespacedState(ctx, metadataPrefix, totalSupplyKey, encodeScalar(totalSupply.String()))
+}
+
+// checkpointSnapshot stores the value of the amount kept under the objectType and key as its value at the current snapshot
+// Only the first change after a snapshot writes a checkpoint, later changes leave it untouched
+func checkpointSnapshot(ctx contractapi.TransactionContextInterface, objectType string, key string) error {
+
+	current, err := currentSnapshotID(ctx)
+	if err != nil || current == 0 {
+		return err
+	}
+
+	checkpointKey, err := ctx.GetStub().CreateCompositeKey(snapshotCheckpointPrefix, []string{objectType, key, fmt.Sprintf(snapshotIDFormat, current)})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", snapshotCheckpointPrefix, err)
+	}
+
+	checkpointBytes, err := ctx.GetStub().GetState(checkpointKey)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot checkpoint from world state: %v", err)
+	}
+	if checkpointBytes != nil {
+		return nil
+	}
+
+	valueBytes, err := getNamespacedState(ctx, objectType, key)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+
+	err = ctx.GetStub().PutState(checkpointKey, encodeScalar(parseStoredAmount(valueBytes).String()))
+	if err != nil {
+		return fmt.Errorf("failed to put snapshot checkpoint to world state: %v", err)
+	}
+
+	return nil
+}
+
+// valueAtSnapshot returns the amount kept under the objectType and key at the time of the snapshot
+// It is the first checkpoint at or after the snapshot, or the current value when it has not changed since the snapshot
+func valueAtSnapshot(ctx contractapi.TransactionContextInterface, objectType string, key string, snapshotID int) (*big.Int, error) {
+
+	checkpointIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(snapshotCheckpointPrefix, []string{objectType, key})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshot checkpoints of %s: %v", key, err)
+	}
+	defer checkpointIterator.Close()
+
+	for checkpointIterator.HasNext() {
+		queryResponse, err := checkpointIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot checkpoint of %s: %v", key, err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split the composite key %s: %v", queryResponse.Key, err)
+		}
+		checkpointID, err := strconv.Atoi(attributes[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot checkpoint %s: %v", queryResponse.Key, err)
+		}
+		if checkpointID >= snapshotID {
+			return parseStoredAmount(queryResponse.Value), nil
+		}
+	}
+
+	valueBytes, err := getNamespacedState(ctx, objectType, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from world state: %v", key, err)
+	}
+
+	return parseStoredAmount(valueBytes), nil
+}
+
+// currentSnapshotID returns the ID of the latest snapshot, 0 before the first snapshot
+func currentSnapshotID(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	currentBytes, err := getNamespacedState(ctx, metadataPrefix, currentSnapshotKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read current snapshot from world state: %v", err)
+	}
+	if currentBytes == nil {
+		return 0, nil
+	}
+
+	current, err := strconv.Atoi(decodeScalar(currentBytes))
+	if err != nil {
+		return 0, fmt.Errorf("invalid current snapshot %s: %v", currentBytes, err)
+	}
+
+	return current, nil
+}
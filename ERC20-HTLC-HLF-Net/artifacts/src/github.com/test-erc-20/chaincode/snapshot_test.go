@@ -0,0 +1,98 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+func TestSnapshot(t *testing.T) {
+	sc := mocks.NewScenario()
+	bank := sc.AdminIdentity(bankID, "Org1MSP")
+	alice := sc.Identity(aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	require.NoError(t, sc.Submit(func() error { return contract.Initialize(bank, "erc20", "BETH", 0) }).Err)
+	for _, role := range []string{"minter", "burner"} {
+		require.NoError(t, sc.Submit(func() error { return contract.GrantRole(bank, role, bankID) }).Err)
+	}
+	require.NoError(t, sc.Submit(func() error { return contract.Mint(bank, "100") }).Err)
+
+	result := sc.Submit(func() error { _, err := contract.Snapshot(alice); return err })
+	require.EqualError(t, result.Err, "client is not authorized to take snapshots")
+
+	// Taking a snapshot copies no balance
+	var first int
+	result = sc.Submit(func() error {
+		var err error
+		first, err = contract.Snapshot(bank)
+		return err
+	})
+	require.NoError(t, result.Err)
+	require.Equal(t, 1, first)
+	require.Equal(t, "Snapshot", result.Event.Name)
+	var snapshot chaincode.SnapshotInfo
+	require.NoError(t, result.Event.Decode(&snapshot))
+	require.Equal(t, 1, snapshot.ID)
+	require.Equal(t, bankID, snapshot.Sender)
+	require.Len(t, result.Changes, 2)
+
+	info, err := contract.GetSnapshot(alice, first)
+	require.NoError(t, err)
+	require.Equal(t, snapshot.Timestamp, info.Timestamp)
+
+	// The first change after the snapshot checkpoints the previous value, later changes keep it
+	result = sc.Submit(func() error { return contract.Transfer(bank, aliceID, "30") })
+	require.NoError(t, result.Err)
+	require.Equal(t, mocks.StateChange{After: "100"}, result.Changes["snapshotCheckpoint~balance~"+bankID+"~00000000000000000001"])
+	require.Equal(t, mocks.StateChange{After: "0"}, result.Changes["snapshotCheckpoint~balance~"+aliceID+"~00000000000000000001"])
+	require.NoError(t, sc.Submit(func() error { return contract.Transfer(bank, aliceID, "20") }).Err)
+	require.NoError(t, sc.Submit(func() error { return contract.TransferConditional(alice, bankID, "10", secretHashLock, "1h", "") }).Err)
+
+	var second int
+	require.NoError(t, sc.Submit(func() error {
+		var err error
+		second, err = contract.Snapshot(bank)
+		return err
+	}).Err)
+	require.Equal(t, 2, second)
+
+	require.NoError(t, sc.Submit(func() error { return contract.Burn(bank, "50") }).Err)
+	require.NoError(t, sc.Submit(func() error { return contract.Claim(bank, secretHashLock, secretPreimageHex) }).Err)
+
+	for _, tc := range []struct {
+		snapshotID  int
+		account     string
+		available   string
+		locked      string
+		totalSupply string
+	}{
+		{first, bankID, "100", "0", "100"},
+		{first, aliceID, "0", "0", "100"},
+		{second, bankID, "50", "0", "100"},
+		{second, aliceID, "40", "10", "100"},
+	} {
+		balance, err := contract.BalanceOfAt(alice, tc.account, tc.snapshotID)
+		require.NoError(t, err)
+		require.Equal(t, &chaincode.AccountBalance{Account: tc.account, Available: tc.available, Locked: tc.locked, OnHold: "0"}, balance)
+
+		totalSupply, err := contract.TotalSupplyAt(alice, tc.snapshotID)
+		require.NoError(t, err)
+		require.Equal(t, tc.totalSupply, totalSupply)
+	}
+
+	// The current values are unaffected
+	balance, err := contract.BalanceOf(alice, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "10", balance.Available)
+	totalSupply, err := contract.TotalSupply(alice)
+	require.NoError(t, err)
+	require.Equal(t, "50", totalSupply)
+
+	_, err = contract.BalanceOfAt(alice, bankID, 3)
+	require.EqualError(t, err, "snapshot 3 does not exist")
+	_, err = contract.TotalSupplyAt(alice, 0)
+	require.EqualError(t, err, "snapshot 0 does not exist")
+}
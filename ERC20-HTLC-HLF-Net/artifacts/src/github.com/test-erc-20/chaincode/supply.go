@@ -0,0 +1,301 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key name of the supply cap, stored under the metadata object type
+const maxSupplyKey = "maxSupply"
+
+// Define objectType names for the daily mint quotas and the amount minted in the current period
+const (
+	mintQuotaPrefix = "mintQuota"
+	mintUsagePrefix = "mintUsage"
+)
+
+// mintPeriodLayout formats the UTC day of a transaction timestamp, mint quotas reset when it changes
+const mintPeriodLayout = "2006-01-02"
+
+// MintQuota reports the daily mint quota of a minter and how much of it is used
+type MintQuota struct {
+	Minter    string `json:"minter"`
+	Quota     string `json:"quota"`
+	Period    string `json:"period"`
+	Minted    string `json:"minted"`
+	Remaining string `json:"remaining"`
+}
+
+// mintUsage is the amount minted by a minter during a period, stored in the world state
+type mintUsage struct {
+	Period        string `json:"period"`
+	Minted        string `json:"minted"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// limitEvent is the payload of the MaxSupplyChanged and MintQuotaChanged events
+type limitEvent struct {
+	Minter   string `json:"minter,omitempty"`
+	Previous string `json:"previous"`
+	Value    string `json:"value"`
+	Sender   string `json:"sender"`
+}
+
+// SetMaxSupply sets the maximum total supply, mints beyond it are rejected
+// A maxSupply of 0 removes the cap. The cap can not be set below the current total supply
+// Only clients with the admin role can set the cap. This function triggers a MaxSupplyChanged event
+func (s *SmartContract) SetMaxSupply(ctx contractapi.TransactionContextInterface, maxSupply string) error {
+
+	// Check admin authorization
+	admin, err := requireRole(ctx, adminRole, "client is not authorized to change supply limits")
+	if err != nil {
+		return err
+	}
+
+	value, err := parseAmount(maxSupply)
+	if err != nil {
+		return err
+	}
+	if value.Sign() < 0 {
+		return fmt.Errorf("maximum supply cannot be negative")
+	}
+
+	totalSupplyBytes, err := getNamespacedState(ctx, metadataPrefix, totalSupplyKey)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
+	totalSupply := parseStoredAmount(totalSupplyBytes)
+	if value.Sign() > 0 && value.Cmp(totalSupply) < 0 {
+		return fmt.Errorf("maximum supply %s is below the current total supply %s", value, totalSupply)
+	}
+
+	previous, err := maxSupplyHelper(ctx)
+	if err != nil {
+		return err
+	}
+
+	if value.Sign() == 0 {
+		err = delNamespacedState(ctx, metadataPrefix, maxSupplyKey)
+	} else {
+		err = putNamespacedState(ctx, metadataPrefix, maxSupplyKey, encodeScalar(value.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update maximum supply: %v", err)
+	}
+
+	log.Printf("maximum supply changed from %s to %s by %s", previous, value, admin)
+
+	return emitLimitEvent(ctx, "MaxSupplyChanged", limitEvent{Previous: previous.String(), Value: value.String(), Sender: admin})
+}
+
+// MaxSupply returns the maximum total supply, 0 when the supply is not capped
+func (s *SmartContract) MaxSupply(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	maxSupply, err := maxSupplyHelper(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return maxSupply.String(), nil
+}
+
+// SetMintQuota sets the amount a minter can mint per day, days are UTC days of the transaction timestamp
+// A quota of 0 removes the limit. Lowering the quota does not undo mints already made today
+// Only clients with the admin role can set quotas. This function triggers a MintQuotaChanged event
+func (s *SmartContract) SetMintQuota(ctx contractapi.TransactionContextInterface, minter string, quota string) error {
+
+	// Check admin authorization
+	admin, err := requireRole(ctx, adminRole, "client is not authorized to change supply limits")
+	if err != nil {
+		return err
+	}
+
+	if minter == "" {
+		return fmt.Errorf("minter must not be empty")
+	}
+
+	value, err := parseAmount(quota)
+	if err != nil {
+		return err
+	}
+	if value.Sign() < 0 {
+		return fmt.Errorf("mint quota cannot be negative")
+	}
+
+	previous, _, err := mintQuotaHelper(ctx, minter)
+	if err != nil {
+		return err
+	}
+
+	if value.Sign() == 0 {
+		err = delNamespacedState(ctx, mintQuotaPrefix, minter)
+	} else {
+		err = putNamespacedState(ctx, mintQuotaPrefix, minter, encodeScalar(value.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update mint quota of %s: %v", minter, err)
+	}
+
+	log.Printf("mint quota of %s changed from %s to %s by %s", minter, previous, value, admin)
+
+	return emitLimitEvent(ctx, "MintQuotaChanged", limitEvent{Minter: minter, Previous: previous.String(), Value: value.String(), Sender: admin})
+}
+
+// GetMintQuota returns the daily mint quota of a minter and the amount minted today
+// Quota and Remaining are 0 when the minter has no quota
+func (s *SmartContract) GetMintQuota(ctx contractapi.TransactionContextInterface, minter string) (*MintQuota, error) {
+
+	quota, _, err := mintQuotaHelper(ctx, minter)
+	if err != nil {
+		return nil, err
+	}
+
+	period, minted, err := mintUsageHelper(ctx, minter)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := new(big.Int)
+	if quota.Cmp(minted) > 0 {
+		remaining.Sub(quota, minted)
+	}
+
+	return &MintQuota{
+		Minter:    minter,
+		Quota:     quota.String(),
+		Period:    period,
+		Minted:    minted.String(),
+		Remaining: remaining.String(),
+	}, nil
+}
+
+// checkMintLimits checks a mint against the supply cap and the daily quota of the minter
+// It returns the usage of the quota including the mint, for the caller to store once the mint succeeds, nil when the minter has no quota
+func checkMintLimits(ctx contractapi.TransactionContextInterface, minter string, amount *big.Int) (*mintUsage, error) {
+
+	maxSupply, err := maxSupplyHelper(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totalSupplyBytes, err := getNamespacedState(ctx, metadataPrefix, totalSupplyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
+	totalSupply, err := add(parseStoredAmount(totalSupplyBytes), amount)
+	if err != nil {
+		return nil, err
+	}
+	if maxSupply.Sign() > 0 && totalSupply.Cmp(maxSupply) > 0 {
+		return nil, fmt.Errorf("mint of %s would exceed the maximum supply of %s", amount, maxSupply)
+	}
+
+	quota, found, err := mintQuotaHelper(ctx, minter)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	period, minted, err := mintUsageHelper(ctx, minter)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedMinted, err := add(minted, amount)
+	if err != nil {
+		return nil, err
+	}
+	if updatedMinted.Cmp(quota) > 0 {
+		return nil, fmt.Errorf("mint of %s would exceed the daily mint quota of %s for %s, already minted %s today", amount, quota, minter, minted)
+	}
+
+	return &mintUsage{Period: period, Minted: updatedMinted.String(), SchemaVersion: schemaVersion}, nil
+}
+
+// putMintUsage stores the usage of the daily quota of the minter
+func putMintUsage(ctx contractapi.TransactionContextInterface, minter string, usage *mintUsage) error {
+
+	usageJSON, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = putNamespacedState(ctx, mintUsagePrefix, minter, usageJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update mint usage of %s: %v", minter, err)
+	}
+
+	return nil
+}
+
+// maxSupplyHelper reads the supply cap from the world state, 0 when the supply is not capped
+func maxSupplyHelper(ctx contractapi.TransactionContextInterface) (*big.Int, error) {
+
+	maxSupplyBytes, err := getNamespacedState(ctx, metadataPrefix, maxSupplyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read maximum supply from world state: %v", err)
+	}
+
+	return parseStoredAmount(maxSupplyBytes), nil
+}
+
+// mintQuotaHelper reads the daily mint quota of a minter, reporting whether one is set
+func mintQuotaHelper(ctx contractapi.TransactionContextInterface, minter string) (*big.Int, bool, error) {
+
+	quotaBytes, err := getNamespacedState(ctx, mintQuotaPrefix, minter)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read mint quota of %s from world state: %v", minter, err)
+	}
+
+	return parseStoredAmount(quotaBytes), quotaBytes != nil, nil
+}
+
+// mintUsageHelper returns the current period and the amount the minter has minted during it
+// Usage recorded for an earlier period does not count
+func mintUsageHelper(ctx contractapi.TransactionContextInterface, minter string) (string, *big.Int, error) {
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	period := now.Format(mintPeriodLayout)
+
+	usageBytes, err := getNamespacedState(ctx, mintUsagePrefix, minter)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read mint usage of %s from world state: %v", minter, err)
+	}
+	if usageBytes == nil {
+		return period, new(big.Int), nil
+	}
+
+	var usage mintUsage
+	err = json.Unmarshal(usageBytes, &usage)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal mint usage of %s: %v", minter, err)
+	}
+	if usage.Period != period {
+		return period, new(big.Int), nil
+	}
+
+	return period, parseStoredAmount([]byte(usage.Minted)), nil
+}
+
+// emitLimitEvent emits the named supply limit event
+func emitLimitEvent(ctx contractapi.TransactionContextInterface, name string, payload limitEvent) error {
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMaxSupply(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "600") }))
+
+	err := submit(stub, func() error { return contract.SetMaxSupply(alice, "1000") })
+	require.EqualError(t, err, "client is not authorized to change supply limits")
+
+	err = submit(stub, func() error { return contract.SetMaxSupply(bank, "500") })
+	require.EqualError(t, err, "maximum supply 500 is below the current total supply 600")
+
+	require.NoError(t, submit(stub, func() error { return contract.SetMaxSupply(bank, "1000") }))
+	require.Equal(t, "MaxSupplyChanged", stub.Event.Name)
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &payload))
+	require.Equal(t, map[string]string{"previous": "0", "value": "1000", "sender": bankID}, payload)
+
+	maxSupply, err := contract.MaxSupply(alice)
+	require.NoError(t, err)
+	require.Equal(t, "1000", maxSupply)
+
+	err = submit(stub, func() error { return contract.Mint(bank, "401") })
+	require.EqualError(t, err, "failed to mint: mint of 401 would exceed the maximum supply of 1000")
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "400") }))
+
+	// Burning makes room for new mints
+	require.NoError(t, submit(stub, func() error { return contract.Burn(bank, "100") }))
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	// A cap of 0 removes the cap
+	require.NoError(t, submit(stub, func() error { return contract.SetMaxSupply(bank, "0") }))
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "5000") }))
+	totalSupply, err := contract.TotalSupply(alice)
+	require.NoError(t, err)
+	require.Equal(t, "6000", totalSupply)
+}
+
+func TestMintQuota(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	stub.TxTimestamp = timestamppb.New(time.Date(2023, 3, 1, 23, 0, 0, 0, time.UTC))
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	err := submit(stub, func() error { return contract.SetMintQuota(alice, bankID, "100") })
+	require.EqualError(t, err, "client is not authorized to change supply limits")
+
+	require.NoError(t, submit(stub, func() error { return contract.SetMintQuota(bank, bankID, "100") }))
+	require.Equal(t, "MintQuotaChanged", stub.Event.Name)
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &payload))
+	require.Equal(t, bankID, payload["minter"])
+	require.Equal(t, "100", payload["value"])
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "60") }))
+	err = submit(stub, func() error { return contract.Mint(bank, "41") })
+	require.EqualError(t, err, "failed to mint: mint of 41 would exceed the daily mint quota of 100 for "+bankID+", already minted 60 today")
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "40") }))
+
+	quota, err := contract.GetMintQuota(alice, bankID)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.MintQuota{Minter: bankID, Quota: "100", Period: "2023-03-01", Minted: "100", Remaining: "0"}, quota)
+
+	// The quota resets at the next UTC day of the transaction timestamp
+	stub.TxTimestamp = timestamppb.New(time.Date(2023, 3, 2, 0, 30, 0, 0, time.UTC))
+	quota, err = contract.GetMintQuota(alice, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "100", quota.Remaining)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	// A quota of 0 removes the limit
+	require.NoError(t, submit(stub, func() error { return contract.SetMintQuota(bank, bankID, "0") }))
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "1000") }))
+
+	balance, err := contract.BalanceOf(alice, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "1200", balance.Available)
+}
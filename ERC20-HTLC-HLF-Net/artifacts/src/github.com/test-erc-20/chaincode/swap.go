@@ -0,0 +1,112 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// An atomic swap of this token against a token of a second deployment of this contract, on another channel or under
+// another chaincode name, uses one HTLC on each side under the same hashLock:
+//  1. the initiator, who knows the preimage, locks its tokens for the responder with TransferConditional
+//  2. the responder locks its tokens for the initiator with TransferConditionalSwap, which checks the initiator's lock
+//  3. the initiator claims the responder's tokens with Claim, revealing the preimage
+//  4. the responder claims the initiator's tokens with ClaimSwap, which reads the revealed preimage from the other side
+// The other deployment is only read, through InvokeChaincode, as writes to another channel are not committed by Fabric
+
+// TransferConditionalSwap locks tokens like TransferConditional, as the second leg of an atomic swap
+// It first reads the first leg, the HTLC of the same hashLock on the remote chaincode, and checks that it is locked,
+// uses the same hash algorithm, pays the calling client, comes from the recipient of this leg, and expires after this leg,
+// so that the caller still has time to claim the first leg once the preimage is revealed here
+// remoteChannel is the channel of the remote chaincode, empty for the channel of this transaction
+// This function triggers a HTLCLocked event
+func (s *SmartContract) TransferConditionalSwap(ctx contractapi.TransactionContextInterface, recipient string, amount string, hashLock string, timeLock string, hashAlgorithm string, remoteChaincode string, remoteChannel string) error {
+
+	// Any client can lock tokens from its own balance
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	remote, err := remoteHTLCHelper(ctx, remoteChaincode, remoteChannel, hashLock)
+	if err != nil {
+		return err
+	}
+
+	// Check the first leg before locking anything, with the same normalization as transferConditionalHelper
+	normalizedAlgorithm, err := normalizeHashAlgorithm(hashAlgorithm)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	timeLockTime, err := parseTimeLock(timeLock, now)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case remote.State != htlcStateLocked:
+		return fmt.Errorf("invalid swap: remote HTLC is %s", remote.State)
+	case remote.HashAlgorithm != normalizedAlgorithm:
+		return fmt.Errorf("invalid swap: remote HTLC uses %s, expected %s", remote.HashAlgorithm, normalizedAlgorithm)
+	case remote.Recipient != clientID:
+		return fmt.Errorf("invalid swap: remote HTLC does not pay the client")
+	case remote.Sender != recipient:
+		return fmt.Errorf("invalid swap: remote HTLC is not locked by the recipient %s", recipient)
+	case !remote.TimeLock.After(timeLockTime):
+		return fmt.Errorf("invalid swap: remote HTLC expires at %s, before this HTLC", remote.TimeLock.Format("2006-01-02 15:04:05"))
+	}
+
+	htlc, err := transferConditionalHelper(ctx, clientID, recipient, amount, hashLock, timeLock, hashAlgorithm, "")
+	if err != nil {
+		return err
+	}
+
+	return emitHTLCEvent(ctx, htlcLockedEvent, htlc)
+}
+
+// ClaimSwap claims the HTLC of the hashLock with the preimage revealed by the claim of the remote HTLC of the same hashLock
+// The preimage is verified against the local hashLock, so the remote chaincode does not need to be trusted
+// remoteChannel is the channel of the remote chaincode, empty for the channel of this transaction
+// This function triggers a HTLCClaimed event
+func (s *SmartContract) ClaimSwap(ctx contractapi.TransactionContextInterface, hashLock string, remoteChaincode string, remoteChannel string) error {
+
+	remote, err := remoteHTLCHelper(ctx, remoteChaincode, remoteChannel, hashLock)
+	if err != nil {
+		return err
+	}
+	if remote.State != htlcStateClaimed || remote.Preimage == "" {
+		return fmt.Errorf("invalid claim: preimage is not revealed on chaincode %s, remote HTLC is %s", remoteChaincode, remote.State)
+	}
+
+	htlc, err := claimHelper(ctx, hashLock, remote.Preimage)
+	if err != nil {
+		return err
+	}
+
+	return emitHTLCEvent(ctx, htlcClaimedEvent, htlc)
+}
+
+// remoteHTLCHelper reads the HTLC of the hashLock from another deployment of this contract
+func remoteHTLCHelper(ctx contractapi.TransactionContextInterface, remoteChaincode string, remoteChannel string, hashLock string) (*HTLC, error) {
+
+	if remoteChaincode == "" {
+		return nil, fmt.Errorf("remote chaincode must not be empty")
+	}
+
+	hashLock, err := normalizeHashLock(hashLock)
+	if err != nil {
+		return nil, err
+	}
+
+	response := ctx.GetStub().InvokeChaincode(remoteChaincode, [][]byte{[]byte("GetHashTimeLock"), []byte(hashLock)}, remoteChannel)
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to read remote HTLC from chaincode %s: %s", remoteChaincode, response.Message)
+	}
+
+	return unmarshalHTLC(response.Payload)
+}
@@ -0,0 +1,91 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+)
+
+// serveHashTimeLock answers GetHashTimeLock calls made through InvokeChaincode, like the peer does for a deployed contract
+func serveHashTimeLock(contract chaincode.SmartContract, ctx contractapi.TransactionContextInterface) func(args [][]byte) peer.Response {
+	return func(args [][]byte) peer.Response {
+		if string(args[0]) != "GetHashTimeLock" {
+			return peer.Response{Status: 500, Message: "unexpected function " + string(args[0])}
+		}
+		htlc, err := contract.GetHashTimeLock(ctx, string(args[1]))
+		if err != nil {
+			return peer.Response{Status: 500, Message: err.Error()}
+		}
+		payload, err := json.Marshal(htlc)
+		if err != nil {
+			return peer.Response{Status: 500, Message: err.Error()}
+		}
+		return peer.Response{Status: 200, Payload: payload}
+	}
+}
+
+func TestCrossChaincodeSwap(t *testing.T) {
+	// Token A is deployed as tokenA on mychannel, token B as tokenB on swapchannel
+	stubA := mocks.NewChaincodeStub()
+	stubB := mocks.NewChaincodeStub()
+	stubB.ChannelID = "swapchannel"
+	contractA := chaincode.SmartContract{}
+	contractB := chaincode.SmartContract{}
+	bankA := newAdminContext(stubA, bankID, "Org1MSP")
+	aliceA := newContext(stubA, aliceID, "Org2MSP")
+	bankB := newAdminContext(stubB, bankID, "Org1MSP")
+	aliceB := newContext(stubB, aliceID, "Org2MSP")
+	stubA.Chaincodes["swapchannel/tokenB"] = serveHashTimeLock(contractB, aliceB)
+	stubB.Chaincodes["mychannel/tokenA"] = serveHashTimeLock(contractA, aliceA)
+
+	initializeBank(t, contractA, bankA)
+	require.NoError(t, submit(stubA, func() error { return contractA.Mint(bankA, "100") }))
+	initializeBank(t, contractB, bankB)
+	require.NoError(t, submit(stubB, func() error { return contractB.Mint(bankB, "100") }))
+	require.NoError(t, submit(stubB, func() error { return contractB.Transfer(bankB, aliceID, "50") }))
+
+	// The bank knows the preimage and locks token A for Alice first
+	require.NoError(t, submit(stubA, func() error { return contractA.TransferConditional(bankA, aliceID, "30", secretHashLock, "48h", "") }))
+
+	// Alice only locks token B once the first leg is in place, and must expire first
+	err := submit(stubB, func() error {
+		return contractB.TransferConditionalSwap(aliceB, bankID, "20", secretHashLock, "72h", "", "tokenA", "mychannel")
+	})
+	require.ErrorContains(t, err, "invalid swap: remote HTLC expires at")
+	err = submit(stubB, func() error {
+		return contractB.TransferConditionalSwap(aliceB, malloryID, "20", secretHashLock, "24h", "", "tokenA", "mychannel")
+	})
+	require.EqualError(t, err, "invalid swap: remote HTLC is not locked by the recipient "+malloryID)
+	err = submit(stubB, func() error {
+		return contractB.TransferConditionalSwap(aliceB, bankID, "20", secretHashLock, "24h", "", "tokenA", "otherchannel")
+	})
+	require.EqualError(t, err, "failed to read remote HTLC from chaincode tokenA: chaincode tokenA not found on channel otherchannel")
+	require.NoError(t, submit(stubB, func() error {
+		return contractB.TransferConditionalSwap(aliceB, bankID, "20", secretHashLock, "24h", "", "tokenA", "mychannel")
+	}))
+	require.Equal(t, "HTLCLocked", stubB.Event.Name)
+
+	err = submit(stubA, func() error { return contractA.ClaimSwap(aliceA, secretHashLock, "tokenB", "swapchannel") })
+	require.EqualError(t, err, "invalid claim: preimage is not revealed on chaincode tokenB, remote HTLC is LOCKED")
+
+	// Claiming token B reveals the preimage, which completes the swap on token A
+	require.NoError(t, submit(stubB, func() error { return contractB.Claim(bankB, secretHashLock, "secret") }))
+	require.NoError(t, submit(stubA, func() error { return contractA.ClaimSwap(aliceA, secretHashLock, "tokenB", "swapchannel") }))
+	require.Equal(t, "HTLCClaimed", stubA.Event.Name)
+
+	aliceBalanceA, err := contractA.BalanceOf(aliceA, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "30", aliceBalanceA.Available)
+	bankBalanceB, err := contractB.BalanceOf(bankB, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "70", bankBalanceB.Available)
+	aliceBalanceB, err := contractB.BalanceOf(aliceB, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "30", aliceBalanceB.Available)
+	require.Equal(t, "0", aliceBalanceB.Locked)
+}
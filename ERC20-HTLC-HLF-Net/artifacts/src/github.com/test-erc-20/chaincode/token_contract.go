@@ -1,26 +1,51 @@
 package chaincode
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"time"
 	"log"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"golang.org/x/crypto/sha3"
 )
 
-// Define key names for options
-const nameKey = "erc20"
-const symbolKey = "BETH"
+// Define key names for options, stored under the metadata object type
+const nameKey = "name"
+const symbolKey = "symbol"
 const decimalsKey = "decimals"
 const totalSupplyKey = "totalSupply"
 
 // Define objectType names for prefix
+const balancePrefix = "balance"
+const htlcPrefix = "htlc"
+const metadataPrefix = "metadata"
 const allowancePrefix = "allowance"
+const htlcEscrowPrefix = "htlcEscrow"
+const lockedBalancePrefix = "lockedBalance"
+
+// Define hash algorithm names accepted for hash locks
+const hashAlgorithmSHA256 = "SHA256"
+const hashAlgorithmSHA3256 = "SHA3-256"
+const hashAlgorithmKeccak256 = "KECCAK256"
+
+// Define the lifecycle states of a HTLC, a lock moves from LOCKED to either CLAIMED or REFUNDED
+const htlcStateLocked = "LOCKED"
+const htlcStateClaimed = "CLAIMED"
+const htlcStateRefunded = "REFUNDED"
 
-// Define key names for options
+// Define HTLC event names
+const htlcLockedEvent = "HTLCLocked"
+const htlcClaimedEvent = "HTLCClaimed"
+const htlcRefundedEvent = "HTLCRefunded"
 
 // SmartContract provides functions for transferring tokens between accounts
 type SmartContract struct {
@@ -28,269 +53,348 @@ type SmartContract struct {
 }
 
 // HTLC represents the Hash Time-Lock contract
+// LockID is derived from the sender, recipient, hashLock and creating transaction ID, HTLCs created before it existed have none
+// When the terms are private, Recipient and Amount are kept in the HTLC terms collection and TermsHash is their SHA256 digest
+// Holds are stored as HTLCs with a Notary, their HashLock is the hold ID
 type HTLC struct {
+	LockID        string    `json:"lockID,omitempty"`
 	Sender        string    `json:"sender"`
 	Recipient     string    `json:"recipient"`
-	Amount        int      `json:"amount"`
+	Amount        string    `json:"amount"`
 	HashLock      string    `json:"hashLock"`
+	HashAlgorithm string    `json:"hashAlgorithm"`
 	TimeLock      time.Time `json:"timeLock"`
-	Claimed       bool      `json:"claimed"`
-	Reverted      bool      `json:"reverted"`
-	ClaimPassword string    `json:"claimPassword"`
+	State         string    `json:"state"`
+	Preimage      string    `json:"preimage,omitempty"`
+	TermsHash     string    `json:"termsHash,omitempty"`
+	Fee           string    `json:"fee,omitempty"`
+	Treasury      string    `json:"treasury,omitempty"`
+	Notary        string    `json:"notary,omitempty"`
+	SchemaVersion int       `json:"schemaVersion"`
+}
+
+// AccountBalance reports the spendable balance of an account separately from the tokens it has locked in HTLC escrow
+// OnHold is the part of the locked balance reserved by holds, the balanceOnHold of ERC-1996
+// Amounts are base 10 integer strings in the smallest token unit
+type AccountBalance struct {
+	Account   string `json:"account"`
+	Available string `json:"available"`
+	Locked    string `json:"locked"`
+	OnHold    string `json:"onHold"`
+}
+
+// Allowance is an allowance granted by the owner to the spender, as returned by ListAllowances
+type Allowance struct {
+	Owner   string `json:"owner"`
+	Spender string `json:"spender"`
+	Value   string `json:"value"`
 }
 
 // event provides an organized struct for emitting events
 type event struct {
 	From  string `json:"from"`
 	To    string `json:"to"`
-	Value int    `json:"value"`
+	Value string `json:"value"`
 }
 
-// TransferConditional creates the conditional transfer from one account to another one, conditioned to hashlock + timelock
-func (s *SmartContract) TransferConditional(ctx contractapi.TransactionContextInterface, recipient string, amount int, hashLock string, timeLock string, claimPassword string) error {
-	
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
-	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to do Conditional Transfer")
-	}
-	
-	// Get ID of submitting client identity
+// TransferConditional creates the conditional transfer from the client account to another one, conditioned to hashlock + timelock
+// This function triggers a HTLCLocked event
+// hashLock is the hex encoded digest of the secret preimage, computed with hashAlgorithm (SHA256 when empty, SHA3-256 or KECCAK256)
+// timeLock is either an RFC3339 timestamp or a duration such as "24h" counted from the transaction timestamp
+func (s *SmartContract) TransferConditional(ctx contractapi.TransactionContextInterface, recipient string, amount string, hashLock string, timeLock string, hashAlgorithm string) error {
+
+	// Any client can lock tokens from its own balance
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	err = transferHelper(ctx, clientID, recipient, amount)
+	htlc, err := transferConditionalHelper(ctx, clientID, recipient, amount, hashLock, timeLock, hashAlgorithm, "")
 	if err != nil {
-		return fmt.Errorf("failed to transfer: %v", err)
+		return err
 	}
 
-	// Parse timeLock string to time.Time
-	timeLockTime, err := time.Parse(time.RFC3339, timeLock)
-	if err != nil {
-		return fmt.Errorf("failed to parse timeLock: %v", err)
-	}
+	return emitHTLCEvent(ctx, htlcLockedEvent, htlc)
+}
 
-	htlc := HTLC{
-		Sender:        clientID,
-		Recipient:     recipient,
-		Amount:        amount,
-		HashLock:      hashLock,
-		TimeLock:      timeLockTime,
-		ClaimPassword: claimPassword,
-	}
+// GetHashTimeLock returns the created Hash Time-Lock, identified by either its hashLock or its lock ID
+func (s *SmartContract) GetHashTimeLock(ctx contractapi.TransactionContextInterface, id string) (*HTLC, error) {
 
-	// Store the HTLC details in the world state
-	htlcBytes, err := json.Marshal(htlc)
-	if err != nil {
-		return fmt.Errorf("failed to marshal HTLC details: %v", err)
-	}
+	return htlcHelper(ctx, id)
+}
+
+// Claim releases the lock and transfers the tokens to the "to" account
+// It can be submitted by any client on the channel that knows the preimage
+// preimage is the secret whose digest matches the hashLock, either as plain text or as 0x prefixed hex bytes
+// This function triggers a HTLCClaimed event revealing the preimage
+func (s *SmartContract) Claim(ctx contractapi.TransactionContextInterface, hashLock string, preimage string) error {
 
-	err = ctx.GetStub().PutState(hashLock, htlcBytes)
+	htlc, err := claimHelper(ctx, hashLock, preimage)
 	if err != nil {
-		return fmt.Errorf("failed to put HTLC details in the world state: %v", err)
+		return err
 	}
 
-	return nil
+	return emitHTLCEvent(ctx, htlcClaimedEvent, htlc)
 }
 
-// GetHashTimeLock returns the created Hash Time-Lock
-func (s *SmartContract) GetHashTimeLock(ctx contractapi.TransactionContextInterface, hashLock string) (*HTLC, error) {
-	htlcBytes, err := ctx.GetStub().GetState(hashLock)
+// Revert releases the lock and transfers the tokens to the "from" account
+// Only the sender that created the lock can revert it
+// This function triggers a HTLCRefunded event
+func (s *SmartContract) Revert(ctx contractapi.TransactionContextInterface, hashLock string) error {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read HTLC details from the world state: %v", err)
-	}
-	if htlcBytes == nil {
-		return nil, fmt.Errorf("HTLC not found for hashLock: %s", hashLock)
+		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	var htlc HTLC
-	err = json.Unmarshal(htlcBytes, &htlc)
+	htlc, err := revertHelper(ctx, clientID, hashLock)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal HTLC details: %v", err)
+		return err
 	}
 
-	return &htlc, nil
+	return emitHTLCEvent(ctx, htlcRefundedEvent, htlc)
 }
 
-// Claim releases the lock and transfers the tokens to the "to" account
-func (s *SmartContract) Claim(ctx contractapi.TransactionContextInterface, hashLock string, claimPassword string) error {
+// Initialize sets the token options: name, symbol and number of decimals
+// It can only be called once, and only by an admin identity of the Org1 organization, which becomes the admin of the role registry
+func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals int) error {
 
-	// Check minter authorization 
+	// Only an admin of the deploying organization can bootstrap the contract, its other clients can not
 	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
 		return fmt.Errorf("failed to get MSPID: %v", err)
 	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to Claim")
-	}
-	htlc, err := s.GetHashTimeLock(ctx, hashLock)
+	orgAdmin, err := isOrgAdmin(ctx)
 	if err != nil {
 		return err
 	}
+	if clientMSPID != "Org1MSP" || !orgAdmin {
+		return fmt.Errorf("client is not authorized to initialize contract")
+	}
 
-	clientID, err := ctx.GetClientIdentity().GetID()
+	adminID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
 
-	if htlc.Claimed {
-		return fmt.Errorf("invalid claim: HTLC already claimed")
-	} else if htlc.Reverted {
-		return fmt.Errorf("invalid claim: HTLC already reverted")
-	} else if htlc.ClaimPassword != claimPassword {
-		return fmt.Errorf("invalid claim: incorrect claim password")
-	} else if time.Now().Before(htlc.TimeLock) {
-		nowStr := time.Now().Format("2006-01-02 15:04:05")
-		lockStr := htlc.TimeLock.Format("2006-01-02 15:04:05")
-		return fmt.Errorf("invalid claim: timelock not yet expired-now:%s ,lock:%s",nowStr,lockStr)
+	// Check contract options are not already set, client is not authorized to change them once intitialized
+	nameBytes, err := getNamespacedState(ctx, metadataPrefix, nameKey)
+	if err != nil {
+		return fmt.Errorf("failed to read token name from world state: %v", err)
+	}
+	if nameBytes != nil {
+		return errors.New("contract options are already set, client is not authorized to change them")
+	}
+
+	if name == "" || symbol == "" {
+		return errors.New("token name and symbol must not be empty")
 	}
 
+	// Decimals follow the ERC-20 uint8 range
+	if decimals < 0 || decimals > 255 {
+		return fmt.Errorf("decimals must be between 0 and 255, got %d", decimals)
+	}
 
-	// Transfer tokens to the recipient
-	err = s.Transfer(ctx,clientID, htlc.Recipient, htlc.Amount)
+	err = putNamespacedState(ctx, metadataPrefix, nameKey, encodeScalar(name))
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to set token name: %v", err)
 	}
 
-	// Mark HTLC as claimed
-	htlc.Claimed = true
-	htlcBytes, err := json.Marshal(htlc)
+	err = putNamespacedState(ctx, metadataPrefix, symbolKey, encodeScalar(symbol))
+	if err != nil {
+		return fmt.Errorf("failed to set symbol: %v", err)
+	}
+
+	err = putNamespacedState(ctx, metadataPrefix, decimalsKey, encodeScalar(strconv.Itoa(decimals)))
+	if err != nil {
+		return fmt.Errorf("failed to set token decimals: %v", err)
+	}
+
+	// A new deployment starts with the current schema and needs no migration
+	err = putNamespacedState(ctx, metadataPrefix, schemaVersionKey, encodeScalar(strconv.Itoa(schemaVersion)))
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated HTLC details: %v", err)
+		return fmt.Errorf("failed to set schema version: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(hashLock, htlcBytes)
+	// The initializing client administers the role registry
+	err = grantRoleHelper(ctx, adminRole, adminID)
 	if err != nil {
-		return fmt.Errorf("failed to update HTLC details in the world state: %v", err)
+		return fmt.Errorf("failed to grant %s role: %v", adminRole, err)
 	}
 
 	return nil
 }
 
-// Revert releases the lock and transfers the tokens to the "from" account
-func (s *SmartContract) Revert(ctx contractapi.TransactionContextInterface, hashLock string) error {	
+// isOrgAdmin reports whether the client certificate is the one of an organization admin: with the admin
+// organizational unit of NodeOUs, or the hf.Type=admin attribute of identities registered as admins with a Fabric CA
+func isOrgAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
 
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	certificate, err := ctx.GetClientIdentity().GetX509Certificate()
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
+		return false, fmt.Errorf("failed to get client certificate: %v", err)
 	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to Revert")
+	if certificate != nil {
+		for _, unit := range certificate.Subject.OrganizationalUnit {
+			if unit == "admin" {
+				return true, nil
+			}
+		}
 	}
-	htlc, err := s.GetHashTimeLock(ctx, hashLock)
+
+	identityType, found, err := ctx.GetClientIdentity().GetAttributeValue("hf.Type")
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to get attribute hf.Type: %v", err)
 	}
 
+	return found && identityType == "admin", nil
+}
 
-	////////////////////////////////////
-	if htlc.Claimed {
-		return fmt.Errorf("invalid Revert: HTLC already claimed")
-	} else if htlc.Reverted {
-		return fmt.Errorf("invalid Revert: HTLC already reverted")
-	} else if time.Now().Before(htlc.TimeLock) {
-		return fmt.Errorf("invalid Revert: timelock not yet expired")
-	}
-	////////////////////////////////////
-	clientID, err := ctx.GetClientIdentity().GetID()
-	// Transfer tokens back to the sender
-	err = s.Transfer(ctx, htlc.Recipient,clientID, htlc.Amount)
+// Name returns a descriptive name for fungible tokens in this contract
+func (s *SmartContract) Name(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	bytes, err := getNamespacedState(ctx, metadataPrefix, nameKey)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to get Name bytes: %v", err)
+	}
+	if bytes == nil {
+		return "", errors.New("token name is not set, call Initialize first")
 	}
 
-	// Mark HTLC as reverted
-	htlc.Reverted = true
-	htlcBytes, err := json.Marshal(htlc)
+	return decodeScalar(bytes), nil
+}
+
+// Symbol returns an abbreviated name for fungible tokens in this contract
+func (s *SmartContract) Symbol(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	bytes, err := getNamespacedState(ctx, metadataPrefix, symbolKey)
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated HTLC details: %v", err)
+		return "", fmt.Errorf("failed to get Symbol bytes: %v", err)
 	}
+	if bytes == nil {
+		return "", errors.New("token symbol is not set, call Initialize first")
+	}
+
+	return decodeScalar(bytes), nil
+}
+
+// Decimals returns the number of decimals used to display token amounts
+// Amounts are always stored in the smallest unit, e.g. with 18 decimals "1000000000000000000" is 1 token
+func (s *SmartContract) Decimals(ctx contractapi.TransactionContextInterface) (int, error) {
 
-	err = ctx.GetStub().PutState(hashLock, htlcBytes)
+	bytes, err := getNamespacedState(ctx, metadataPrefix, decimalsKey)
 	if err != nil {
-		return fmt.Errorf("failed to update HTLC details in the world state: %v", err)
+		return 0, fmt.Errorf("failed to get Decimals bytes: %v", err)
+	}
+	if bytes == nil {
+		return 0, errors.New("token decimals are not set, call Initialize first")
 	}
 
-	return nil
-}
+	decimals, _ := strconv.Atoi(decodeScalar(bytes)) // Error handling not needed since Itoa() was used when setting the decimals, guaranteeing it was an integer.
 
+	return decimals, nil
+}
 
 // Mint creates new tokens and adds them to minter's account balance
+// Only clients with the minter role can mint, within the maximum supply and the daily mint quota of the minter
+// Mints above the approval threshold must go through ProposeMint instead
 // This function triggers a Transfer event
-func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount int) error {
+func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount string) error {
 
-	// Check minter authorization 
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check minter authorization
+	minter, err := requireRole(ctx, minterRole, "client is not authorized to mint new tokens")
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+		return err
 	}
 
-	// Get ID of submitting client identity
-	minter, err := ctx.GetClientIdentity().GetID()
+	mintAmount, err := parseAmount(amount)
 	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
+		return err
 	}
 
-	if amount <= 0 {
+	if mintAmount.Sign() <= 0 {
 		return fmt.Errorf("mint amount must be a positive integer")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
+	err = checkApprovalThreshold(ctx, mintAmount)
 	if err != nil {
-		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+		return fmt.Errorf("failed to mint: %v", err)
 	}
 
-	var currentBalance int
+	return mintHelper(ctx, minter, mintAmount)
+}
 
-	// If minter current balance doesn't yet exist, we'll create it with a current balance of 0
-	if currentBalanceBytes == nil {
-		currentBalance = 0
-	} else {
-		currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+// mintHelper creates new tokens and adds them to the minter's account balance
+func mintHelper(ctx contractapi.TransactionContextInterface, minter string, mintAmount *big.Int) error {
+
+	err := checkTransferable(ctx, minter)
+	if err != nil {
+		return fmt.Errorf("failed to mint: %v", err)
+	}
+
+	err = recordClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Enforce the supply cap and the daily quota of the minter
+	usage, err := checkMintLimits(ctx, minter, mintAmount)
+	if err != nil {
+		return fmt.Errorf("failed to mint: %v", err)
+	}
+
+	currentBalanceBytes, err := getNamespacedState(ctx, balancePrefix, minter)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
 	}
 
-	updatedBalance, err := add(currentBalance, amount)
+	// If minter current balance doesn't yet exist, we'll create it with a current balance of 0
+	currentBalance := parseStoredAmount(currentBalanceBytes)
+
+	updatedBalance, err := add(currentBalance, mintAmount)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalance(ctx, minter, updatedBalance)
 	if err != nil {
 		return err
 	}
 
 	// Update the totalSupply
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	totalSupplyBytes, err := getNamespacedState(ctx, metadataPrefix, totalSupplyKey)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	var totalSupply int
-
 	// If no tokens have been minted, initialize the totalSupply
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
-	}
+	totalSupply := parseStoredAmount(totalSupplyBytes)
 
 	// Add the mint amount to the total supply and update the state
-	totalSupply, err = add(totalSupply, amount)
+	totalSupply, err = add(totalSupply, mintAmount)
+	if err != nil {
+		return err
+	}
+
+	err = putTotalSupply(ctx, totalSupply)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	if usage != nil {
+		err = putMintUsage(ctx, minter, usage)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordHistory(ctx, minter, historyMint, "0x0", mintAmount, "")
 	if err != nil {
 		return err
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{"0x0", minter, amount}
+	transferEvent := event{"0x0", minter, mintAmount.String()}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -300,60 +404,72 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("minter account %s balance updated from %d to %d", minter, currentBalance, updatedBalance)
+	log.Printf("minter account %s balance updated from %s to %s", minter, currentBalance, updatedBalance)
 
 	return nil
 }
 
 // Burn redeems tokens the minter's account balance
+// Only clients with the burner role can burn
+// Burns above the approval threshold must go through ProposeBurn instead
 // This function triggers a Transfer event
-func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount int) error {
+func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount string) error {
 
-	// Check minter authorization
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check burner authorization
+	minter, err := requireRole(ctx, burnerRole, "client is not authorized to burn tokens")
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+		return err
 	}
 
-	// Get ID of submitting client identity
-	minter, err := ctx.GetClientIdentity().GetID()
+	burnAmount, err := parseAmount(amount)
 	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
+		return err
 	}
 
-	if amount <= 0 {
+	if burnAmount.Sign() <= 0 {
 		return errors.New("burn amount must be a positive integer")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
+	err = checkApprovalThreshold(ctx, burnAmount)
 	if err != nil {
-		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+		return fmt.Errorf("failed to burn: %v", err)
+	}
+
+	return burnHelper(ctx, minter, burnAmount)
+}
+
+// burnHelper redeems tokens from the minter's account balance
+func burnHelper(ctx contractapi.TransactionContextInterface, minter string, burnAmount *big.Int) error {
+
+	err := checkTransferable(ctx, minter)
+	if err != nil {
+		return fmt.Errorf("failed to burn: %v", err)
 	}
 
-	var currentBalance int
+	currentBalanceBytes, err := getNamespacedState(ctx, balancePrefix, minter)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+	}
 
 	// Check if minter current balance exists
 	if currentBalanceBytes == nil {
 		return errors.New("The balance does not exist")
 	}
 
-	currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	currentBalance := parseStoredAmount(currentBalanceBytes)
 
-	updatedBalance, err := sub(currentBalance, amount)
+	updatedBalance, err := sub(currentBalance, burnAmount)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalance(ctx, minter, updatedBalance)
 	if err != nil {
 		return err
 	}
 
 	// Update the totalSupply
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	totalSupplyBytes, err := getNamespacedState(ctx, metadataPrefix, totalSupplyKey)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
@@ -363,21 +479,26 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount
 		return errors.New("totalSupply does not exist")
 	}
 
-	totalSupply, _ := strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	totalSupply := parseStoredAmount(totalSupplyBytes)
 
 	// Subtract the burn amount to the total supply and update the state
-	totalSupply, err = sub(totalSupply, amount)
+	totalSupply, err = sub(totalSupply, burnAmount)
+	if err != nil {
+		return err
+	}
+
+	err = putTotalSupply(ctx, totalSupply)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	err = recordHistory(ctx, minter, historyBurn, "0x0", burnAmount, "")
 	if err != nil {
 		return err
 	}
 
 	// Emit the Transfer event
-	transferEvent := event{minter, "0x0", amount}
+	transferEvent := event{minter, "0x0", burnAmount.String()}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -387,7 +508,7 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to set event: %v", err)
 	}
 
-	log.Printf("minter account %s balance updated from %d to %d", minter, currentBalance, updatedBalance)
+	log.Printf("minter account %s balance updated from %s to %s", minter, currentBalance, updatedBalance)
 
 	return nil
 }
@@ -395,70 +516,44 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount
 // Transfer transfers tokens from client account to recipient account
 // recipient account must be a valid clientID as returned by the ClientID() function
 // This function triggers a Transfer event
-func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface,sender string, recipient string, amount int) error {
+func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount string) error {
 
-	// Get ID of submitting client identity
-	//clientID, err := ctx.GetClientIdentity().GetID()
-	// if err != nil {
-	// 	return fmt.Errorf("failed to get client id: %v", err)
-	// }
-
-	err := transferHelper(ctx, sender, recipient, amount)
+	// Get ID of submitting client identity, the sender can only ever be the caller
+	sender, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to transfer: %v", err)
+		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	// Emit the Transfer event
-	transferEvent := event{sender, recipient, amount}
-	transferEventJSON, err := json.Marshal(transferEvent)
+	transferAmount, err := parseAmount(amount)
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		return err
 	}
-	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
+
+	charge, err := transferHelper(ctx, sender, recipient, transferAmount)
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return fmt.Errorf("failed to transfer: %v", err)
 	}
 
-	return nil
+	return emitTransferEvent(ctx, sender, recipient, transferAmount, charge)
 }
 
 // BalanceOf returns the balance of the given account
-func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
-
-	balanceBytes, err := ctx.GetStub().GetState(account)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if balanceBytes == nil {
-		return 0, fmt.Errorf("the account %s does not exist", account)
-	}
-
-	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+// The available balance can be spent, while the locked balance is held in HTLC escrow, including the balance on hold
+func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (*AccountBalance, error) {
 
-	return balance, nil
+	return accountBalanceHelper(ctx, account)
 }
 
 // ClientAccountBalance returns the balance of the requesting client's account
-func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (int, error) {
-
+func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (*AccountBalance, error) {
 
 	// Get ID of submitting client identity
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get client id: %v", err)
-	}
-
-	balanceBytes, err := ctx.GetStub().GetState(clientID)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, fmt.Errorf("failed to get client id: %v", err)
 	}
-	if balanceBytes == nil {
-		return 0, fmt.Errorf("the account %s does not exist", clientID)
-	}
-
-	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
 
-	return balance, nil
+	return accountBalanceHelper(ctx, clientID)
 }
 
 // ClientAccountID returns the id of the requesting client's account
@@ -476,35 +571,28 @@ func (s *SmartContract) ClientAccountID(ctx contractapi.TransactionContextInterf
 }
 
 // TotalSupply returns the total token supply
-func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
-
-	
+func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface) (string, error) {
 
 	// Retrieve total supply of tokens from state of smart contract
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	totalSupplyBytes, err := getNamespacedState(ctx, metadataPrefix, totalSupplyKey)
 	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve total token supply: %v", err)
+		return "", fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	var totalSupply int
-
 	// If no tokens have been minted, return 0
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
-	}
+	totalSupply := parseStoredAmount(totalSupplyBytes)
 
-	log.Printf("TotalSupply: %d tokens", totalSupply)
+	log.Printf("TotalSupply: %s tokens", totalSupply)
 
-	return totalSupply, nil
+	return totalSupply.String(), nil
 }
 
 // Approve allows the spender to withdraw from the calling client's token account
 // The spender can withdraw multiple times if necessary, up to the value amount
+// Approving a value of 0 removes the allowance. To change an existing allowance without racing a pending
+// TransferFrom of the spender, use IncreaseAllowance, DecreaseAllowance or ApproveIfCurrent instead
 // This function triggers an Approval event
-func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spender string, value int) error {
-
+func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spender string, value string) error {
 
 	// Get ID of submitting client identity
 	owner, err := ctx.GetClientIdentity().GetID()
@@ -512,146 +600,773 @@ func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spe
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	allowanceValue, err := parseAmount(value)
 	if err != nil {
-		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return err
 	}
 
-	// Update the state of the smart contract by adding the allowanceKey and value
-	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(value)))
+	return approveHelper(ctx, owner, spender, allowanceValue)
+}
+
+// IncreaseAllowance atomically increases the allowance of the spender on the calling client's token account
+// This function triggers an Approval event with the updated allowance
+func (s *SmartContract) IncreaseAllowance(ctx contractapi.TransactionContextInterface, spender string, addedValue string) error {
+
+	// Get ID of submitting client identity
+	owner, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
+		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	// Emit the Approval event
-	approvalEvent := event{owner, spender, value}
-	approvalEventJSON, err := json.Marshal(approvalEvent)
+	increase, err := parseAmount(addedValue)
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		return err
 	}
-	err = ctx.GetStub().SetEvent("Approval", approvalEventJSON)
-	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+	if increase.Sign() <= 0 {
+		return fmt.Errorf("allowance increase must be a positive integer")
 	}
 
-	log.Printf("client %s approved a withdrawal allowance of %d for spender %s", owner, value, spender)
-
-	return nil
-}
-
-// Allowance returns the amount still available for the spender to withdraw from the owner
-func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
-
-	
-
-	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	currentAllowance, _, err := allowanceHelper(ctx, owner, spender)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return err
 	}
 
-	// Read the allowance amount from the world state
-	allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	updatedAllowance, err := add(currentAllowance, increase)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
-	}
-
-	var allowance int
-
-	// If no current allowance, set allowance to 0
-	if allowanceBytes == nil {
-		allowance = 0
-	} else {
-		allowance, err = strconv.Atoi(string(allowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+		return err
 	}
 
-	log.Printf("The allowance left for spender %s to withdraw from owner %s: %d", spender, owner, allowance)
-
-	return allowance, nil
+	return approveHelper(ctx, owner, spender, updatedAllowance)
 }
 
-// TransferFrom transfers the value amount from the "from" address to the "to" address
-// This function triggers a Transfer event
-func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
-
+// DecreaseAllowance atomically decreases the allowance of the spender on the calling client's token account
+// The allowance can not be decreased below zero
+// This function triggers an Approval event with the updated allowance
+func (s *SmartContract) DecreaseAllowance(ctx contractapi.TransactionContextInterface, spender string, subtractedValue string) error {
 
 	// Get ID of submitting client identity
-	spender, err := ctx.GetClientIdentity().GetID()
+	owner, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{from, spender})
+	decrease, err := parseAmount(subtractedValue)
 	if err != nil {
-		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		return err
+	}
+	if decrease.Sign() <= 0 {
+		return fmt.Errorf("allowance decrease must be a positive integer")
 	}
 
-	// Retrieve the allowance of the spender
-	currentAllowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	currentAllowance, _, err := allowanceHelper(ctx, owner, spender)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve the allowance for %s from world state: %v", allowanceKey, err)
+		return err
 	}
 
-	var currentAllowance int
-	currentAllowance, _ = strconv.Atoi(string(currentAllowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
-
-	// Check if transferred value is less than allowance
-	if currentAllowance < value {
-		return fmt.Errorf("spender does not have enough allowance- for transfer")
+	if currentAllowance.Cmp(decrease) < 0 {
+		return fmt.Errorf("decreased allowance below zero: current allowance of spender %s is %s", spender, currentAllowance)
 	}
 
-	// Initiate the transfer
-	err = transferHelper(ctx, from, to, value)
+	updatedAllowance := new(big.Int).Sub(currentAllowance, decrease)
+
+	return approveHelper(ctx, owner, spender, updatedAllowance)
+}
+
+// ApproveIfCurrent sets the allowance of the spender to value, only if the current allowance equals expected
+// It fails when the spender used part of the allowance since the owner read it, so the owner can decide again
+// This function triggers an Approval event
+func (s *SmartContract) ApproveIfCurrent(ctx contractapi.TransactionContextInterface, spender string, expected string, value string) error {
+
+	// Get ID of submitting client identity
+	owner, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to transfer: %v", err)
+		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	// Decrease the allowance
-	updatedAllowance, err := sub(currentAllowance, value)
+	expectedValue, err := parseAmount(expected)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(updatedAllowance)))
+	allowanceValue, err := parseAmount(value)
 	if err != nil {
 		return err
 	}
 
-	// Emit the Transfer event
-	transferEvent := event{from, to, value}
-	transferEventJSON, err := json.Marshal(transferEvent)
-	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
-	}
-	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
+	currentAllowance, _, err := allowanceHelper(ctx, owner, spender)
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return err
 	}
 
-	log.Printf("spender %s allowance updated from %d to %d", spender, currentAllowance, updatedAllowance)
+	if currentAllowance.Cmp(expectedValue) != 0 {
+		return fmt.Errorf("allowance of spender %s is %s, expected %s", spender, currentAllowance, expectedValue)
+	}
 
-	return nil
+	return approveHelper(ctx, owner, spender, allowanceValue)
 }
 
+// Allowance returns the amount still available for the spender to withdraw from the owner
+func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (string, error) {
 
+	// If no current allowance, set allowance to 0
+	allowance, _, err := allowanceHelper(ctx, owner, spender)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("The allowance left for spender %s to withdraw from owner %s: %s", spender, owner, allowance)
+
+	return allowance.String(), nil
+}
+
+// ListAllowances returns every allowance the owner has granted
+func (s *SmartContract) ListAllowances(ctx contractapi.TransactionContextInterface, owner string) ([]*Allowance, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(allowancePrefix, []string{owner})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query allowances of %s: %v", owner, err)
+	}
+	defer resultsIterator.Close()
+
+	allowances := []*Allowance{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read allowances of %s: %v", owner, err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split the composite key %s: %v", queryResponse.Key, err)
+		}
+
+		allowances = append(allowances, &Allowance{
+			Owner:   attributes[0],
+			Spender: attributes[1],
+			Value:   parseStoredAmount(queryResponse.Value).String(),
+		})
+	}
+
+	return allowances, nil
+}
+
+// TransferFrom transfers the value amount from the "from" address to the "to" address
+// This function triggers a Transfer event
+func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value string) error {
+
+	// Get ID of submitting client identity
+	spender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// A frozen spender can not use its allowances, the from and to accounts are checked by transferHelper
+	err = checkNotFrozen(ctx, spender)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	transferValue, err := parseAmount(value)
+	if err != nil {
+		return err
+	}
+
+	// Retrieve the allowance of the spender
+	currentAllowance, found, err := allowanceHelper(ctx, from, spender)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("spender %s has no allowance from %s", spender, from)
+	}
+
+	// Check if transferred value is less than allowance
+	if currentAllowance.Cmp(transferValue) < 0 {
+		return fmt.Errorf("spender does not have enough allowance- for transfer")
+	}
+
+	// Initiate the transfer
+	charge, err := transferHelper(ctx, from, to, transferValue)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	// Decrease the allowance, transferHelper already rejected negative values
+	updatedAllowance := new(big.Int).Sub(currentAllowance, transferValue)
+
+	err = putAllowance(ctx, from, spender, updatedAllowance)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("spender %s allowance updated from %s to %s", spender, currentAllowance, updatedAllowance)
+
+	return emitTransferEvent(ctx, from, to, transferValue, charge)
+}
+
+// Helper Functions
+
+// transferHelper is a helper function that transfers tokens from the "from" address to the "to" address
+// It does not check who is calling, so the dependant functions Transfer and TransferFrom must authorize the "from" account first
+// It returns the fee charged on the transfer, nil when no fee was due
+func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value *big.Int) (*feeCharge, error) {
+
+	err := checkTransferable(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// The organization of the submitting client decides the fees of later transfers from and to its account
+	err = recordClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if from == to {
+		return nil, fmt.Errorf("cannot transfer to and from same client account")
+	}
+
+	if value.Sign() < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
+		return nil, fmt.Errorf("transfer amount cannot be negative")
+	}
+
+	// A transfer of 0 moves no tokens and leaves the balances as they are, only its Transfer event is emitted
+	if value.Sign() == 0 {
+		return nil, nil
+	}
+
+	fromCurrentBalanceBytes, err := getNamespacedState(ctx, balancePrefix, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client account %s from world state: %v", from, err)
+	}
+
+	if fromCurrentBalanceBytes == nil {
+		return nil, fmt.Errorf("client account %s has no balance", from)
+	}
+
+	fromCurrentBalance := parseStoredAmount(fromCurrentBalanceBytes)
+
+	if fromCurrentBalance.Cmp(value) < 0 {
+		return nil, fmt.Errorf("client account %s has insufficient funds", from)
+	}
+
+	toCurrentBalanceBytes, err := getNamespacedState(ctx, balancePrefix, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipient account %s from world state: %v", to, err)
+	}
+
+	// If recipient current balance doesn't yet exist, we'll create it with a current balance of 0
+	toCurrentBalance := parseStoredAmount(toCurrentBalanceBytes)
+
+	fromUpdatedBalance, err := sub(fromCurrentBalance, value)
+	if err != nil {
+		return nil, err
+	}
+
+	// A fee due on the transfer is deducted from the amount the recipient receives
+	charge, err := feeHelper(ctx, from, to, value)
+	if err != nil {
+		return nil, err
+	}
+	received := value
+	if charge != nil {
+		received = new(big.Int).Sub(value, charge.Amount)
+	}
+
+	toUpdatedBalance, err := add(toCurrentBalance, received)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putBalance(ctx, from, fromUpdatedBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putBalance(ctx, to, toUpdatedBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordHistory(ctx, from, historyTransferOut, to, value, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordHistory(ctx, to, historyTransferIn, from, received, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if charge != nil {
+		err = payFee(ctx, from, charge)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("client %s balance updated from %s to %s", from, fromCurrentBalance, fromUpdatedBalance)
+	log.Printf("recipient %s balance updated from %s to %s", to, toCurrentBalance, toUpdatedBalance)
+
+	return charge, nil
+}
+
+// transferConditionalHelper locks tokens of the sender in escrow and stores the HTLC
+// termsHash is empty unless the recipient and amount were stored in the HTLC terms collection
+// Dependant functions include TransferConditional, TransferConditionalPrivate and TransferConditionalBatch, which emit the events
+func transferConditionalHelper(ctx contractapi.TransactionContextInterface, sender string, recipient string, amount string, hashLock string, timeLock string, hashAlgorithm string, termsHash string) (*HTLC, error) {
+
+	lockAmount, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashLock, err = normalizeHashLock(hashLock)
+	if err != nil {
+		return nil, err
+	}
+
+	hashAlgorithm, err = normalizeHashAlgorithm(hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if sender == recipient {
+		return nil, fmt.Errorf("cannot lock tokens to and from same client account")
+	}
+
+	err = checkTransferable(ctx, sender, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A hashLock can only be used once, locking it again would overwrite its escrow account
+	// Once claimed its preimage is public, and a refunded HTLC stays readable under its hashLock
+	existingBytes, err := getNamespacedState(ctx, htlcPrefix, hashLock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTLC details from the world state: %v", err)
+	}
+	if existingBytes != nil {
+		existing, err := unmarshalHTLC(existingBytes)
+		if err != nil {
+			return nil, err
+		}
+		if existing.State != htlcStateLocked {
+			return nil, fmt.Errorf("hashLock %s was already used by a HTLC that is %s", hashLock, existing.State)
+		}
+		return nil, fmt.Errorf("HTLC already exists for hashLock: %s", hashLock)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse timeLock string to time.Time
+	timeLockTime, err := parseTimeLock(timeLock, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold the tokens in the escrow account of the hashLock until the HTLC is claimed or reverted
+	err = lockInEscrow(ctx, sender, hashLock, lockAmount, termsHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock tokens in escrow: %v", err)
+	}
+
+	// The lock ID of a HTLC with private terms leaves the recipient out, so that it does not reveal it
+	lockIDRecipient := recipient
+	if termsHash != "" {
+		lockIDRecipient = ""
+	}
+
+	htlc := &HTLC{
+		LockID:        htlcLockID(sender, lockIDRecipient, hashLock, ctx.GetStub().GetTxID()),
+		Sender:        sender,
+		Recipient:     recipient,
+		Amount:        lockAmount.String(),
+		HashLock:      hashLock,
+		HashAlgorithm: hashAlgorithm,
+		TimeLock:      timeLockTime,
+		State:         htlcStateLocked,
+		TermsHash:     termsHash,
+	}
+
+	// Store the HTLC details in the world state
+	err = putHTLC(ctx, htlc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordHistory(ctx, sender, historyHTLCLock, publicHTLC(htlc).Recipient, historyAmount(htlc, lockAmount), hashLock)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicHTLC(htlc), nil
+}
+
+// htlcHelper reads the HTLC identified by its hashLock or its lock ID from the world state
+func htlcHelper(ctx contractapi.TransactionContextInterface, id string) (*HTLC, error) {
+
+	hashLock, err := normalizeHashLock(id)
+	if err != nil {
+		return nil, err
+	}
+
+	htlcBytes, err := getNamespacedState(ctx, htlcPrefix, hashLock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTLC details from the world state: %v", err)
+	}
+	if htlcBytes != nil {
+		return unmarshalHTLC(htlcBytes)
+	}
+
+	// Lock IDs have the same format as hashLocks, and are resolved through the lock ID index
+	indexIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(htlcByLockIDPrefix, []string{hashLock})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s index: %v", htlcByLockIDPrefix, err)
+	}
+	defer indexIterator.Close()
+
+	htlcs, err := readIndexedHTLCs(ctx, htlcByLockIDPrefix, indexIterator)
+	if err != nil {
+		return nil, err
+	}
+	if len(htlcs) == 0 {
+		return nil, fmt.Errorf("HTLC not found for hashLock: %s", hashLock)
+	}
+
+	return htlcs[0], nil
+}
+
+// htlcLockID derives the lock ID of a HTLC, the hex encoded SHA256 digest of its sender, recipient, hashLock and transaction ID
+// The transaction ID makes it unique, a HTLC created again with the same terms in another transaction gets another ID
+func htlcLockID(sender string, recipient string, hashLock string, txID string) string {
+
+	digest := sha256.Sum256([]byte(strings.Join([]string{sender, recipient, hashLock, txID}, "|")))
+
+	return hex.EncodeToString(digest[:])
+}
+
+// claimHelper verifies the preimage and releases the escrowed tokens of the HTLC to its recipient
+// Anyone holding the preimage can claim, the tokens always go to the stored recipient
+// Dependant functions include Claim and ClaimBatch, which emit the events
+func claimHelper(ctx contractapi.TransactionContextInterface, hashLock string, preimage string) (*HTLC, error) {
+
+	htlc, err := htlcHelper(ctx, hashLock)
+	if err != nil {
+		return nil, err
+	}
+
+	if htlc.Notary != "" {
+		return nil, fmt.Errorf("invalid claim: %s is a hold, only its notary can execute it", htlc.HashLock)
+	}
+	if htlc.State != htlcStateLocked {
+		return nil, fmt.Errorf("invalid claim: HTLC is %s", htlc.State)
+	}
+
+	err = loadHTLCTerms(ctx, htlc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The escrowed tokens can not be released to a frozen recipient
+	err = checkTransferable(ctx, htlc.Recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := verifyPreimage(htlc, preimage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claim: %v", err)
+	}
+	if !matched {
+		return nil, fmt.Errorf("invalid claim: preimage does not match hashLock")
+	}
+
+	// The recipient can only claim while the timelock is running
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(htlc.TimeLock) {
+		nowStr := now.Format("2006-01-02 15:04:05")
+		lockStr := htlc.TimeLock.Format("2006-01-02 15:04:05")
+		return nil, fmt.Errorf("invalid claim: timelock expired-now:%s ,lock:%s", nowStr, lockStr)
+	}
+
+	// A fee due on the claim is deducted from the tokens released to the recipient
+	amount := parseStoredAmount([]byte(htlc.Amount))
+	charge, err := feeHelper(ctx, htlc.Sender, htlc.Recipient, amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claim: %v", err)
+	}
+	if charge != nil {
+		htlc.Fee = charge.Amount.String()
+		htlc.Treasury = charge.Treasury
+		amount = new(big.Int).Sub(amount, charge.Amount)
+	}
+
+	// Release the escrowed tokens to the recipient
+	err = releaseEscrow(ctx, htlc, htlc.Recipient, charge)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark HTLC as claimed and record the revealed preimage
+	preimageBytes, err := decodePreimage(preimage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claim: %v", err)
+	}
+	htlc.State = htlcStateClaimed
+	htlc.Preimage = "0x" + hex.EncodeToString(preimageBytes)
+
+	err = putHTLC(ctx, htlc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordHistory(ctx, htlc.Recipient, historyHTLCClaim, htlc.Sender, historyAmount(htlc, amount), htlc.HashLock)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicHTLC(htlc), nil
+}
+
+// revertHelper returns the escrowed tokens of an expired HTLC to its sender
+// Only the original sender can revert the lock
+// Dependant functions include Revert and RevertBatch, which emit the events
+func revertHelper(ctx contractapi.TransactionContextInterface, clientID string, hashLock string) (*HTLC, error) {
+
+	htlc, err := htlcHelper(ctx, hashLock)
+	if err != nil {
+		return nil, err
+	}
+
+	if htlc.Notary != "" {
+		return nil, fmt.Errorf("invalid Revert: %s is a hold, use ReleaseHold", htlc.HashLock)
+	}
+	if clientID != htlc.Sender {
+		return nil, fmt.Errorf("client is not authorized to Revert: only the sender of the HTLC can revert it")
+	}
+
+	err = loadHTLCTerms(ctx, htlc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkTransferable(ctx, htlc.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sender can only be refunded once the timelock has expired
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if htlc.State != htlcStateLocked {
+		return nil, fmt.Errorf("invalid Revert: HTLC is %s", htlc.State)
+	} else if now.Before(htlc.TimeLock) {
+		return nil, fmt.Errorf("invalid Revert: timelock not yet expired")
+	}
+	// Return the escrowed tokens to the sender
+	err = releaseEscrow(ctx, htlc, htlc.Sender, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark HTLC as refunded
+	htlc.State = htlcStateRefunded
+
+	err = putHTLC(ctx, htlc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordHistory(ctx, htlc.Sender, historyHTLCRefund, publicHTLC(htlc).Recipient, historyAmount(htlc, parseStoredAmount([]byte(htlc.Amount))), htlc.HashLock)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicHTLC(htlc), nil
+}
+
+// approveHelper validates and stores the allowance of the spender on the owner's account
+// Dependant functions include Approve, IncreaseAllowance, DecreaseAllowance and ApproveIfCurrent
+func approveHelper(ctx contractapi.TransactionContextInterface, owner string, spender string, value *big.Int) error {
+
+	if spender == "" {
+		return fmt.Errorf("spender must not be empty")
+	}
+
+	if spender == owner {
+		return fmt.Errorf("cannot approve an allowance to the owner account itself")
+	}
+
+	if value.Sign() < 0 {
+		return fmt.Errorf("allowance cannot be negative")
+	}
+
+	err := recordClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = putAllowance(ctx, owner, spender, value)
+	if err != nil {
+		return err
+	}
 
-// Helper Functions
-
-// transferHelper is a helper function that transfers tokens from the "from" address to the "to" address
-// Dependant functions include Transfer and TransferFrom
-func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+	// Emit the Approval event
+	approvalEvent := event{owner, spender, value.String()}
+	approvalEventJSON, err := json.Marshal(approvalEvent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Approval", approvalEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
 
-	if from == to {
-		return fmt.Errorf("cannot transfer to and from same client account")
+	log.Printf("client %s approved a withdrawal allowance of %s for spender %s", owner, value, spender)
+
+	return nil
+}
+
+// allowanceHelper reads the allowance of the spender on the owner's account
+// It reports whether the allowance exists, a missing allowance has a value of 0
+func allowanceHelper(ctx contractapi.TransactionContextInterface, owner string, spender string) (*big.Int, bool, error) {
+
+	// Create allowanceKey
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+	}
+
+	// Read the allowance amount from the world state
+	allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
+	}
+
+	return parseStoredAmount(allowanceBytes), allowanceBytes != nil, nil
+}
+
+// putAllowance stores the allowance of the spender on the owner's account, an allowance of 0 is removed
+func putAllowance(ctx contractapi.TransactionContextInterface, owner string, spender string, value *big.Int) error {
+
+	// Create allowanceKey
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+	}
+
+	if value.Sign() == 0 {
+		err = ctx.GetStub().DelState(allowanceKey)
+	} else {
+		err = ctx.GetStub().PutState(allowanceKey, encodeScalar(value.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
+	}
+
+	return nil
+}
+
+// accountBalanceHelper reads the available and locked balances of an account
+// Dependant functions include BalanceOf and ClientAccountBalance
+func accountBalanceHelper(ctx contractapi.TransactionContextInterface, account string) (*AccountBalance, error) {
+
+	balanceBytes, err := getNamespacedState(ctx, balancePrefix, account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+
+	locked, err := lockedBalanceHelper(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	if balanceBytes == nil && locked.Sign() == 0 {
+		return nil, fmt.Errorf("the account %s does not exist", account)
+	}
+
+	available := parseStoredAmount(balanceBytes)
+
+	onHold, err := holdBalanceHelper(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountBalance{Account: account, Available: available.String(), Locked: locked.String(), OnHold: onHold.String()}, nil
+}
+
+// lockedBalanceHelper returns the total amount an account has locked in HTLC escrow
+func lockedBalanceHelper(ctx contractapi.TransactionContextInterface, account string) (*big.Int, error) {
+
+	lockedKey, err := ctx.GetStub().CreateCompositeKey(lockedBalancePrefix, []string{account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", lockedBalancePrefix, err)
 	}
 
-	if value < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
-		return fmt.Errorf("transfer amount cannot be negative")
+	lockedBytes, err := ctx.GetStub().GetState(lockedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read locked balance of %s from world state: %v", account, err)
+	}
+
+	// If the account never locked tokens, the locked balance is 0
+	return parseStoredAmount(lockedBytes), nil
+}
+
+// putLockedBalance stores the total amount an account has locked in HTLC escrow
+func putLockedBalance(ctx contractapi.TransactionContextInterface, account string, locked *big.Int) error {
+
+	err := checkpointSnapshot(ctx, lockedBalancePrefix, account)
+	if err != nil {
+		return err
+	}
+
+	lockedKey, err := ctx.GetStub().CreateCompositeKey(lockedBalancePrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", lockedBalancePrefix, err)
+	}
+
+	if locked.Sign() == 0 {
+		return ctx.GetStub().DelState(lockedKey)
+	}
+
+	return ctx.GetStub().PutState(lockedKey, encodeScalar(locked.String()))
+}
+
+// lockInEscrow moves tokens from the "from" account into the contract owned escrow account of the hashLock
+// The escrow account of a HTLC with private terms holds its terms hash instead of the amount, which stays in the HTLC terms collection
+func lockInEscrow(ctx contractapi.TransactionContextInterface, from string, hashLock string, value *big.Int, termsHash string) error {
+
+	if value.Sign() <= 0 {
+		return fmt.Errorf("lock amount must be a positive integer")
+	}
+
+	escrowKey, err := ctx.GetStub().CreateCompositeKey(htlcEscrowPrefix, []string{hashLock})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", htlcEscrowPrefix, err)
 	}
 
-	fromCurrentBalanceBytes, err := ctx.GetStub().GetState(from)
+	fromCurrentBalanceBytes, err := getNamespacedState(ctx, balancePrefix, from)
 	if err != nil {
 		return fmt.Errorf("failed to read client account %s from world state: %v", from, err)
 	}
@@ -660,78 +1375,417 @@ func transferHelper(ctx contractapi.TransactionContextInterface, from string, to
 		return fmt.Errorf("client account %s has no balance", from)
 	}
 
-	fromCurrentBalance, _ := strconv.Atoi(string(fromCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	fromCurrentBalance := parseStoredAmount(fromCurrentBalanceBytes)
 
-	if fromCurrentBalance < value {
+	if fromCurrentBalance.Cmp(value) < 0 {
 		return fmt.Errorf("client account %s has insufficient funds", from)
 	}
 
-	toCurrentBalanceBytes, err := ctx.GetStub().GetState(to)
+	fromUpdatedBalance, err := sub(fromCurrentBalance, value)
+	if err != nil {
+		return err
+	}
+
+	currentLocked, err := lockedBalanceHelper(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	updatedLocked, err := add(currentLocked, value)
+	if err != nil {
+		return err
+	}
+
+	err = putBalance(ctx, from, fromUpdatedBalance)
+	if err != nil {
+		return err
+	}
+
+	escrowValue := value.String()
+	if termsHash != "" {
+		escrowValue = termsHash
+	}
+	err = ctx.GetStub().PutState(escrowKey, encodeScalar(escrowValue))
+	if err != nil {
+		return err
+	}
+
+	err = putLockedBalance(ctx, from, updatedLocked)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s locked %s tokens in escrow for hashLock %s", from, value, hashLock)
+
+	return nil
+}
+
+// releaseEscrow moves the tokens held in escrow for the HTLC to the "to" account, less the fee paid to the treasury if any
+// Dependant functions include Claim, which releases to the recipient, and Revert, which releases to the sender
+func releaseEscrow(ctx contractapi.TransactionContextInterface, htlc *HTLC, to string, charge *feeCharge) error {
+
+	escrowKey, err := ctx.GetStub().CreateCompositeKey(htlcEscrowPrefix, []string{htlc.HashLock})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", htlcEscrowPrefix, err)
+	}
+
+	escrowBalanceBytes, err := ctx.GetStub().GetState(escrowKey)
+	if err != nil {
+		return fmt.Errorf("failed to read escrow account for hashLock %s from world state: %v", htlc.HashLock, err)
+	}
+
+	if escrowBalanceBytes == nil {
+		return fmt.Errorf("no tokens held in escrow for hashLock %s", htlc.HashLock)
+	}
+
+	// The escrow account of a HTLC with private terms holds the terms hash, the amount comes from the terms checked against it
+	// Escrow accounts of private HTLCs locked by earlier versions of the contract hold the amount
+	escrowBalance := parseStoredAmount(escrowBalanceBytes)
+	if htlc.TermsHash != "" && decodeScalar(escrowBalanceBytes) == htlc.TermsHash {
+		escrowBalance = parseStoredAmount([]byte(htlc.Amount))
+	}
+
+	if escrowBalance.String() != htlc.Amount {
+		return fmt.Errorf("escrow account for hashLock %s holds %s tokens, expected %s", htlc.HashLock, escrowBalance, htlc.Amount)
+	}
+
+	toCurrentBalanceBytes, err := getNamespacedState(ctx, balancePrefix, to)
 	if err != nil {
 		return fmt.Errorf("failed to read recipient account %s from world state: %v", to, err)
 	}
 
-	var toCurrentBalance int
 	// If recipient current balance doesn't yet exist, we'll create it with a current balance of 0
-	if toCurrentBalanceBytes == nil {
-		toCurrentBalance = 0
-	} else {
-		toCurrentBalance, _ = strconv.Atoi(string(toCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	toCurrentBalance := parseStoredAmount(toCurrentBalanceBytes)
+
+	released := escrowBalance
+	if charge != nil {
+		released = new(big.Int).Sub(escrowBalance, charge.Amount)
 	}
 
-	fromUpdatedBalance, err := sub(fromCurrentBalance, value)
+	toUpdatedBalance, err := add(toCurrentBalance, released)
+	if err != nil {
+		return err
+	}
+
+	currentLocked, err := lockedBalanceHelper(ctx, htlc.Sender)
+	if err != nil {
+		return err
+	}
+
+	updatedLocked, err := sub(currentLocked, escrowBalance)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(escrowKey)
 	if err != nil {
 		return err
 	}
 
-	toUpdatedBalance, err := add(toCurrentBalance, value)
+	err = putBalance(ctx, to, toUpdatedBalance)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(from, []byte(strconv.Itoa(fromUpdatedBalance)))
+	err = putLockedBalance(ctx, htlc.Sender, updatedLocked)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(to, []byte(strconv.Itoa(toUpdatedBalance)))
+	if charge != nil {
+		err = payFee(ctx, htlc.Sender, charge)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("escrow for hashLock %s released %s tokens to %s", htlc.HashLock, released, to)
+
+	return nil
+}
+
+// recordClient records what the submitting client reveals about its account: its organization, used by the fee schedule,
+// and the public key of its certificate, used by Permit
+// Dependant functions include the helpers of every transaction moving tokens or setting an allowance
+func recordClient(ctx contractapi.TransactionContextInterface) error {
+
+	err := recordClientMSP(ctx)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, fromUpdatedBalance)
-	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, toUpdatedBalance)
+	return recordClientKey(ctx)
+}
+
+// getNamespacedState reads the value stored under the composite key of the objectType and key
+// Balances, HTLCs and token metadata are namespaced so that a crafted key can never overwrite another kind of state
+func getNamespacedState(ctx contractapi.TransactionContextInterface, objectType string, key string) ([]byte, error) {
+
+	compositeKey, err := ctx.GetStub().CreateCompositeKey(objectType, []string{key})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", objectType, err)
+	}
+
+	return ctx.GetStub().GetState(compositeKey)
+}
+
+// putNamespacedState writes the value under the composite key of the objectType and key
+func putNamespacedState(ctx contractapi.TransactionContextInterface, objectType string, key string, value []byte) error {
+
+	compositeKey, err := ctx.GetStub().CreateCompositeKey(objectType, []string{key})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", objectType, err)
+	}
+
+	return ctx.GetStub().PutState(compositeKey, value)
+}
+
+// delNamespacedState deletes the composite key of the objectType and key
+func delNamespacedState(ctx contractapi.TransactionContextInterface, objectType string, key string) error {
+
+	compositeKey, err := ctx.GetStub().CreateCompositeKey(objectType, []string{key})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", objectType, err)
+	}
+
+	return ctx.GetStub().DelState(compositeKey)
+}
+
+// putHTLC stores the HTLC details in the world state under its hashLock, together with its index keys
+// Private terms loaded into the HTLC are never written to the world state
+func putHTLC(ctx contractapi.TransactionContextInterface, htlc *HTLC) error {
+
+	htlc = publicHTLC(htlc)
+	htlc.SchemaVersion = schemaVersion
+	htlcBytes, err := json.Marshal(htlc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal HTLC details: %v", err)
+	}
+
+	err = putNamespacedState(ctx, htlcPrefix, htlc.HashLock, htlcBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put HTLC details in the world state: %v", err)
+	}
+
+	return putHTLCIndexes(ctx, htlc)
+}
+
+// unmarshalHTLC decodes stored HTLC details
+// Locks written before the state field existed carry claimed/reverted flags, which are mapped onto the state
+func unmarshalHTLC(htlcBytes []byte) (*HTLC, error) {
+
+	var htlc HTLC
+	err := json.Unmarshal(htlcBytes, &htlc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal HTLC details: %v", err)
+	}
+
+	if htlc.State == "" {
+		var legacy struct {
+			Claimed  bool `json:"claimed"`
+			Reverted bool `json:"reverted"`
+		}
+		err = json.Unmarshal(htlcBytes, &legacy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal HTLC details: %v", err)
+		}
+
+		switch {
+		case legacy.Claimed:
+			htlc.State = htlcStateClaimed
+		case legacy.Reverted:
+			htlc.State = htlcStateRefunded
+		default:
+			htlc.State = htlcStateLocked
+		}
+	}
+
+	return &htlc, nil
+}
+
+// emitHTLCEvent emits the named HTLC lifecycle event with the current details of the HTLC
+// The payload is the public HTLC, which carries the sender, recipient and amount, as Fabric only keeps one event per transaction
+// and it replaces the Transfer event
+func emitHTLCEvent(ctx contractapi.TransactionContextInterface, name string, htlc *HTLC) error {
+
+	lifecycleEventJSON, err := json.Marshal(publicHTLC(htlc))
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, lifecycleEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
 
 	return nil
 }
 
-// add two number checking for overflow
-func add(b int, q int) (int, error) {
+// parseAmount parses a token amount given as a base 10 integer string, in the smallest token unit
+func parseAmount(amount string) (*big.Int, error) {
+
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("amount %s is not a valid base 10 integer", amount)
+	}
+
+	return value, nil
+}
+
+// parseStoredAmount parses an amount read from the world state, a missing value is 0
+// Error handling not needed since big.Int String() is used when setting amounts, guaranteeing a base 10 integer
+func parseStoredAmount(amountBytes []byte) *big.Int {
+
+	value, ok := new(big.Int).SetString(decodeScalar(amountBytes), 10)
+	if !ok {
+		return new(big.Int)
+	}
+
+	return value
+}
+
+// add two numbers, big.Int can not overflow but negative operands are rejected
+func add(b *big.Int, q *big.Int) (*big.Int, error) {
+
+	if b.Sign() < 0 || q.Sign() < 0 {
+		return nil, fmt.Errorf("Math: addition of negative numbers %s + %s", b, q)
+	}
+
+	return new(big.Int).Add(b, q), nil
+}
+
+// sub two number checking for underflow
+func sub(b *big.Int, q *big.Int) (*big.Int, error) {
+
+	// sub two number checking
+	if q.Sign() <= 0 {
+		return nil, fmt.Errorf("Error: the subtraction number is %s, it should be greater than 0", q)
+	}
+	if b.Cmp(q) < 0 {
+		return nil, fmt.Errorf("Error: the number %s is not enough to be subtracted by %s", b, q)
+	}
+
+	return new(big.Int).Sub(b, q), nil
+}
+
+// txTimestamp returns the timestamp of the transaction proposal
+// Unlike time.Now(), it is the same on every endorsing peer, keeping endorsements deterministic
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC(), nil
+}
+
+// parseTimeLock parses an RFC3339 timestamp or a duration relative to now into the expiry of a timelock
+// Chaincode has no access to the block height, so swap windows are expressed as durations instead of block counts
+func parseTimeLock(timeLock string, now time.Time) (time.Time, error) {
+
+	var expiry time.Time
+
+	if duration, err := time.ParseDuration(timeLock); err == nil {
+		expiry = now.Add(duration)
+	} else {
+		expiry, err = time.Parse(time.RFC3339, timeLock)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse timeLock %s: expected an RFC3339 timestamp or a duration", timeLock)
+		}
+	}
+
+	// The expiry index orders timelocks by unix nanoseconds, which cover the years 1970 to 2262
+	if expiry.Before(time.Unix(0, 0)) || expiry.After(time.Unix(0, math.MaxInt64)) {
+		return time.Time{}, fmt.Errorf("timeLock %s must be between 1970 and 2262", timeLock)
+	}
+
+	if !expiry.After(now) {
+		return time.Time{}, fmt.Errorf("timeLock %s must be in the future", timeLock)
+	}
+
+	return expiry.UTC(), nil
+}
+
+// normalizeHashLock checks that the hashLock is a hex encoded 32 byte digest
+// and returns it in lower case without the optional 0x prefix
+func normalizeHashLock(hashLock string) (string, error) {
+
+	normalized := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(hashLock, "0x"), "0X"))
+
+	digest, err := hex.DecodeString(normalized)
+	if err != nil || len(digest) != sha256.Size {
+		return "", fmt.Errorf("hashLock %s must be a hex encoded 32 byte digest", hashLock)
+	}
+
+	return normalized, nil
+}
+
+// normalizeHashAlgorithm checks that the hash algorithm is supported, defaulting to SHA256
+func normalizeHashAlgorithm(hashAlgorithm string) (string, error) {
+
+	switch strings.ToUpper(hashAlgorithm) {
+	case "", hashAlgorithmSHA256, "SHA-256":
+		return hashAlgorithmSHA256, nil
+	case hashAlgorithmSHA3256, "SHA3":
+		return hashAlgorithmSHA3256, nil
+	case hashAlgorithmKeccak256, "KECCAK":
+		return hashAlgorithmKeccak256, nil
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm %s", hashAlgorithm)
+	}
+}
+
+// hashPreimage computes the digest of the preimage with the given hash algorithm
+func hashPreimage(hashAlgorithm string, preimage []byte) ([]byte, error) {
+
+	switch hashAlgorithm {
+	case hashAlgorithmSHA256:
+		digest := sha256.Sum256(preimage)
+		return digest[:], nil
+	case hashAlgorithmSHA3256:
+		digest := sha3.Sum256(preimage)
+		return digest[:], nil
+	case hashAlgorithmKeccak256:
+		hasher := sha3.NewLegacyKeccak256()
+		hasher.Write(preimage)
+		return hasher.Sum(nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %s", hashAlgorithm)
+	}
+}
 
-	// Check overflow
-	var sum int
-	sum = q + b
+// decodePreimage returns the preimage bytes, decoding 0x prefixed values as hex
+// so that preimages shared with Ethereum contracts (bytes32) hash to the same digest
+func decodePreimage(preimage string) ([]byte, error) {
 
-	if (sum < q || sum < b) == (b >= 0 && q >= 0) {
-		return 0, fmt.Errorf("Math: addition overflow occurred %d + %d", b, q)
+	if strings.HasPrefix(preimage, "0x") {
+		preimageBytes, err := hex.DecodeString(preimage[2:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode hex preimage: %v", err)
+		}
+		return preimageBytes, nil
 	}
 
-	return sum, nil
+	return []byte(preimage), nil
 }
 
+// verifyPreimage checks whether the digest of the preimage matches the hashLock of the HTLC
+func verifyPreimage(htlc *HTLC, preimage string) (bool, error) {
 
-// sub two number checking for overflow
-func sub(b int, q int) (int, error) {
+	preimageBytes, err := decodePreimage(preimage)
+	if err != nil {
+		return false, err
+	}
 
-	// sub two number checking 
-	if q <= 0 {
-		return 0, fmt.Errorf("Error: the subtraction number is %d, it should be greater than 0", q)
+	digest, err := hashPreimage(htlc.HashAlgorithm, preimageBytes)
+	if err != nil {
+		return false, err
 	}
-	if b < q {
-		return 0, fmt.Errorf("Error: the number %d is not enough to be subtracted by %d", b, q)
+
+	hashLockBytes, err := hex.DecodeString(htlc.HashLock)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode hashLock: %v", err)
 	}
-	var diff int
-	diff = b - q
 
-	return diff, nil
+	return subtle.ConstantTimeCompare(digest, hashLockBytes) == 1, nil
 }
@@ -0,0 +1,642 @@
+package chaincode_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/test-erc-20/chaincode"
+	"github.com/test-erc-20/chaincode/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const bankID = "x509::CN=bank,OU=client::CN=ca.org1.example.com"
+const bondxID = "x509::CN=bondx,OU=client::CN=ca.org1.example.com"
+const aliceID = "x509::CN=alice,OU=client::CN=ca.org2.example.com"
+const malloryID = "x509::CN=mallory,OU=client::CN=ca.org2.example.com"
+
+// secretHashLock is the SHA256 digest of the preimage "secret"
+const secretHashLock = "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+const secretPreimageHex = "0x736563726574"
+
+// newContext returns a transaction context on the stub for the given client identity
+func newContext(stub *mocks.ChaincodeStub, id string, mspID string) *mocks.TransactionContext {
+	return &mocks.TransactionContext{
+		Stub:           stub,
+		ClientIdentity: &mocks.ClientIdentity{ID: id, MSPID: mspID},
+	}
+}
+
+// newAdminContext returns a context for an admin identity of the organization, which can initialize the contract
+func newAdminContext(stub *mocks.ChaincodeStub, id string, mspID string) *mocks.TransactionContext {
+	ctx := newContext(stub, id, mspID)
+	ctx.ClientIdentity.Attributes = map[string]string{"hf.Type": "admin"}
+	return ctx
+}
+
+// nextTx moves the stub to a new transaction, one second after the previous one
+func nextTx(stub *mocks.ChaincodeStub) {
+	txCount++
+	stub.TxID = fmt.Sprintf("tx%d", txCount)
+	stub.TxTimestamp = timestamppb.New(stub.TxTimestamp.AsTime().Add(time.Second))
+}
+
+var txCount = 1
+
+// submit runs fn, which calls one contract function, as a transaction on the stub, see mocks.Scenario.Run
+// Unlike Scenario.Submit it keeps the transaction ID and timestamp of the stub, which tests move with nextTx
+func submit(stub *mocks.ChaincodeStub, fn func() error) error {
+	return (&mocks.Scenario{Stub: stub}).Run(fn).Err
+}
+
+// initializeBank initializes the token with bank as admin, holding the minter, burner and htlcOperator roles
+func initializeBank(t *testing.T, contract chaincode.SmartContract, bank *mocks.TransactionContext) {
+	require.NoError(t, submit(bank.Stub, func() error { return contract.Initialize(bank, "erc20", "BETH", 0) }))
+	for _, role := range []string{"minter", "burner", "htlcOperator"} {
+		require.NoError(t, submit(bank.Stub, func() error { return contract.GrantRole(bank, role, bankID) }))
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	err := submit(stub, func() error { return contract.Transfer(bank, aliceID, "40") })
+	require.NoError(t, err)
+
+	bankBalance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "60", bankBalance.Available)
+
+	aliceBalance, err := contract.BalanceOf(bank, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "40", aliceBalance.Available)
+
+	require.Equal(t, "Transfer", stub.Event.Name)
+	var transferEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &transferEvent))
+	require.Equal(t, bankID, transferEvent["from"])
+	require.Equal(t, aliceID, transferEvent["to"])
+
+	// A transfer of 0 is valid in ERC-20, it emits the event and moves nothing
+	stub.Event = nil
+	require.NoError(t, submit(stub, func() error { return contract.Transfer(bank, bondxID, "0") }))
+	require.Equal(t, "Transfer", stub.Event.Name)
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &transferEvent))
+	require.Equal(t, "0", transferEvent["value"])
+
+	bankBalance, err = contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "60", bankBalance.Available)
+	_, err = contract.BalanceOf(bank, bondxID)
+	require.EqualError(t, err, "the account "+bondxID+" does not exist")
+}
+
+func TestTransferRejectsUnauthorizedSender(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	mallory := newContext(stub, malloryID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	// The sender is always the calling identity, so Mallory can only spend her own (empty) balance
+	err := submit(stub, func() error { return contract.Transfer(mallory, aliceID, "10") })
+	require.EqualError(t, err, "failed to transfer: client account "+malloryID+" has no balance")
+
+	bankBalance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "100", bankBalance.Available)
+
+	_, err = contract.BalanceOf(bank, aliceID)
+	require.EqualError(t, err, "the account "+aliceID+" does not exist")
+}
+
+func TestTransferRejectsInvalidAmounts(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	err := submit(stub, func() error { return contract.Transfer(bank, bankID, "10") })
+	require.EqualError(t, err, "failed to transfer: cannot transfer to and from same client account")
+
+	err = submit(stub, func() error { return contract.Transfer(bank, aliceID, "-1") })
+	require.EqualError(t, err, "failed to transfer: transfer amount cannot be negative")
+
+	err = submit(stub, func() error { return contract.Transfer(bank, aliceID, "101") })
+	require.EqualError(t, err, "failed to transfer: client account "+bankID+" has insufficient funds")
+}
+
+func TestMintRejectsOtherOrganizations(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	err := submit(stub, func() error { return contract.Mint(alice, "100") })
+	require.EqualError(t, err, "client is not authorized to mint new tokens")
+}
+
+func TestTransferRejectsMalformedAmounts(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	err := submit(stub, func() error { return contract.Mint(bank, "1.5") })
+	require.EqualError(t, err, "amount 1.5 is not a valid base 10 integer")
+
+	err = submit(stub, func() error { return contract.Mint(bank, "0") })
+	require.EqualError(t, err, "mint amount must be a positive integer")
+}
+
+func TestAmountsBeyondInt64(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	// 1 million tokens with 18 decimals does not fit in an int64
+	const million = "1000000000000000000000000"
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, million) }))
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, million) }))
+	require.NoError(t, submit(stub, func() error { return contract.Transfer(bank, aliceID, "1") }))
+
+	bankBalance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "1999999999999999999999999", bankBalance.Available)
+
+	totalSupply, err := contract.TotalSupply(bank)
+	require.NoError(t, err)
+	require.Equal(t, "2000000000000000000000000", totalSupply)
+}
+
+func TestInitialize(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	_, err := contract.Decimals(bank)
+	require.EqualError(t, err, "token decimals are not set, call Initialize first")
+
+	err = submit(stub, func() error { return contract.Initialize(alice, "erc20", "BETH", 18) })
+	require.EqualError(t, err, "client is not authorized to initialize contract")
+
+	// Being a client of Org1 is not enough, BondX is not an admin of the organization
+	bondx := newContext(stub, bondxID, "Org1MSP")
+	err = submit(stub, func() error { return contract.Initialize(bondx, "erc20", "BETH", 18) })
+	require.EqualError(t, err, "client is not authorized to initialize contract")
+	orgAdmin := newContext(stub, "x509::CN=Admin@org1.example.com", "Org1MSP")
+	orgAdmin.ClientIdentity.Certificate = &x509.Certificate{Subject: pkix.Name{CommonName: "Admin@org1.example.com", OrganizationalUnit: []string{"admin"}}}
+	err = submit(stub, func() error { return contract.Initialize(orgAdmin, "erc20", "BETH", 256) })
+	require.EqualError(t, err, "decimals must be between 0 and 255, got 256")
+
+	require.NoError(t, submit(stub, func() error { return contract.Initialize(bank, "erc20", "BETH", 18) }))
+
+	name, err := contract.Name(alice)
+	require.NoError(t, err)
+	require.Equal(t, "erc20", name)
+
+	symbol, err := contract.Symbol(alice)
+	require.NoError(t, err)
+	require.Equal(t, "BETH", symbol)
+
+	decimals, err := contract.Decimals(alice)
+	require.NoError(t, err)
+	require.Equal(t, 18, decimals)
+
+	err = submit(stub, func() error { return contract.Initialize(bank, "other", "OTH", 6) })
+	require.EqualError(t, err, "contract options are already set, client is not authorized to change them")
+}
+
+func TestHTLCClaimEmitsPreimage(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "30", secretHashLock, "1h", "") }))
+
+	require.Equal(t, "HTLCLocked", stub.Event.Name)
+	var lockedEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &lockedEvent))
+	require.Equal(t, "LOCKED", lockedEvent["state"])
+	require.Equal(t, "30", lockedEvent["amount"])
+	require.NotContains(t, lockedEvent, "preimage")
+
+	err := submit(stub, func() error { return contract.Claim(alice, secretHashLock, "wrong") })
+	require.EqualError(t, err, "invalid claim: preimage does not match hashLock")
+
+	require.NoError(t, submit(stub, func() error { return contract.Claim(alice, secretHashLock, "secret") }))
+
+	require.Equal(t, "HTLCClaimed", stub.Event.Name)
+	var claimedEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &claimedEvent))
+	require.Equal(t, "CLAIMED", claimedEvent["state"])
+	require.Equal(t, secretPreimageHex, claimedEvent["preimage"])
+
+	htlc, err := contract.GetHashTimeLock(alice, secretHashLock)
+	require.NoError(t, err)
+	require.Equal(t, "CLAIMED", htlc.State)
+	require.Equal(t, secretPreimageHex, htlc.Preimage)
+
+	aliceBalance, err := contract.BalanceOf(alice, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "30", aliceBalance.Available)
+
+	err = submit(stub, func() error { return contract.Claim(alice, secretHashLock, "secret") })
+	require.EqualError(t, err, "invalid claim: HTLC is CLAIMED")
+}
+
+func TestHTLCLockIDs(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	nextTx(stub)
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "30", secretHashLock, "1h", "") }))
+
+	// The lock ID is derived from the sender, recipient, hashLock and transaction ID
+	digest := sha256.Sum256([]byte(bankID + "|" + aliceID + "|" + secretHashLock + "|" + stub.TxID))
+	lockID := hex.EncodeToString(digest[:])
+	var lockedEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &lockedEvent))
+	require.Equal(t, lockID, lockedEvent["lockID"])
+
+	byHashLock, err := contract.GetHashTimeLock(alice, secretHashLock)
+	require.NoError(t, err)
+	byLockID, err := contract.GetHashTimeLock(alice, "0x"+strings.ToUpper(lockID))
+	require.NoError(t, err)
+	require.Equal(t, byHashLock, byLockID)
+	require.Equal(t, lockID, byLockID.LockID)
+
+	_, err = contract.GetHashTimeLock(alice, hashLockOf("unknown"))
+	require.EqualError(t, err, "HTLC not found for hashLock: "+hashLockOf("unknown"))
+
+	// An active hashLock can not be locked again, even for another recipient
+	nextTx(stub)
+	err = submit(stub, func() error { return contract.TransferConditional(bank, malloryID, "10", secretHashLock, "1h", "") })
+	require.EqualError(t, err, "HTLC already exists for hashLock: "+secretHashLock)
+
+	// The lock ID works wherever a hashLock is expected, and a used hashLock stays used
+	nextTx(stub)
+	require.NoError(t, submit(stub, func() error { return contract.Claim(alice, lockID, "secret") }))
+	nextTx(stub)
+	err = submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "10", secretHashLock, "1h", "") })
+	require.EqualError(t, err, "hashLock "+secretHashLock+" was already used by a HTLC that is CLAIMED")
+
+	aliceBalance, err := contract.BalanceOf(alice, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "30", aliceBalance.Available)
+}
+
+func TestHTLCRevertAfterExpiry(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+	require.NoError(t, submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "30", secretHashLock, "1h", "SHA256") }))
+
+	err := submit(stub, func() error { return contract.Revert(bank, secretHashLock) })
+	require.EqualError(t, err, "invalid Revert: timelock not yet expired")
+
+	stub.TxTimestamp = timestamppb.New(stub.TxTimestamp.AsTime().Add(2 * time.Hour))
+
+	err = submit(stub, func() error { return contract.Revert(alice, secretHashLock) })
+	require.EqualError(t, err, "client is not authorized to Revert: only the sender of the HTLC can revert it")
+
+	require.NoError(t, submit(stub, func() error { return contract.Revert(bank, secretHashLock) }))
+
+	require.Equal(t, "HTLCRefunded", stub.Event.Name)
+	var refundedEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &refundedEvent))
+	require.Equal(t, "REFUNDED", refundedEvent["state"])
+	require.Equal(t, bankID, refundedEvent["sender"])
+
+	bankBalance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "100", bankBalance.Available)
+	require.Equal(t, "0", bankBalance.Locked)
+
+	err = submit(stub, func() error { return contract.Claim(alice, secretHashLock, "secret") })
+	require.EqualError(t, err, "invalid claim: HTLC is REFUNDED")
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	// State as written by earlier versions of the contract, under raw keys
+	legacyHashLock := strings.ToUpper(secretHashLock)
+	stub.State[bankID] = []byte("70")
+	stub.State[aliceID] = []byte("0")
+	stub.State["totalSupply"] = []byte("100")
+	stub.State[legacyHashLock] = []byte(`{"sender":"` + bankID + `","recipient":"` + aliceID + `","amount":30,"hashLock":"` + legacyHashLock + `","claimed":true}`)
+
+	// A crafted hashLock can no longer overwrite the total supply
+	err := submit(stub, func() error { return contract.TransferConditional(bank, aliceID, "1", "totalSupply", "1h", "") })
+	require.EqualError(t, err, "hashLock totalSupply must be a hex encoded 32 byte digest")
+
+	initializeBank(t, contract, bank)
+
+	err = submit(stub, func() error { _, err := contract.MigrateLegacyKeys(alice); return err })
+	require.EqualError(t, err, "client is not authorized to migrate keys")
+
+	var result *chaincode.MigrationResult
+	err = submit(stub, func() error {
+		var err error
+		result, err = contract.MigrateLegacyKeys(bank)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Balances)
+	require.Equal(t, 1, result.HTLCs)
+	require.Equal(t, 1, result.Metadata)
+	require.Empty(t, result.Skipped)
+
+	require.NotContains(t, stub.State, bankID)
+	require.NotContains(t, stub.State, legacyHashLock)
+
+	bankBalance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "70", bankBalance.Available)
+
+	totalSupply, err := contract.TotalSupply(bank)
+	require.NoError(t, err)
+	require.Equal(t, "100", totalSupply)
+
+	htlc, err := contract.GetHashTimeLock(bank, secretHashLock)
+	require.NoError(t, err)
+	require.Equal(t, "CLAIMED", htlc.State)
+	require.Equal(t, "30", htlc.Amount)
+
+	// Migrated HTLCs are indexed for the list queries
+	page, err := contract.ListHTLCsBySender(bank, bankID, 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+
+	// Running the migration again finds nothing left to move
+	err = submit(stub, func() error {
+		var err error
+		result, err = contract.MigrateLegacyKeys(bank)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 0, result.Balances+result.HTLCs+result.Metadata)
+}
+
+func TestMigrateLegacyLockedHTLCs(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	compositeKey := func(objectType string, key string) string {
+		compositeKey, err := stub.CreateCompositeKey(objectType, []string{key})
+		require.NoError(t, err)
+		return compositeKey
+	}
+	timeLock := stub.TxTimestamp.AsTime().Add(time.Hour).Format(time.RFC3339)
+
+	// The first release paid the recipient when locking, kept no escrow account and stored a plaintext claim password
+	stub.State[bankID] = []byte("50")
+	stub.State[aliceID] = []byte("30")
+	stub.State[hashLockOf("a")] = []byte(`{"sender":"` + bankID + `","recipient":"` + aliceID + `","amount":30,"hashLock":"` + hashLockOf("a") + `","timeLock":"` + timeLock + `","claimed":false,"reverted":false,"claimPassword":"hunter2"}`)
+	// Later releases kept the tokens in an escrow account under a composite key
+	stub.State[hashLockOf("b")] = []byte(`{"sender":"` + bankID + `","recipient":"` + aliceID + `","amount":"20","hashLock":"` + hashLockOf("b") + `","hashAlgorithm":"SHA256","timeLock":"` + timeLock + `","state":"LOCKED"}`)
+	stub.State[compositeKey("htlcEscrow", hashLockOf("b"))] = []byte("20")
+	stub.State[compositeKey("lockedBalance", bankID)] = []byte("20")
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { _, err := contract.MigrateLegacyKeys(bank); return err }))
+
+	// The HTLC without escrow account is settled, as the recipient already holds the tokens
+	require.NotContains(t, string(stub.State[compositeKey("htlc", hashLockOf("a"))]), "claimPassword")
+	htlc, err := contract.GetHashTimeLock(bank, hashLockOf("a"))
+	require.NoError(t, err)
+	require.Equal(t, "CLAIMED", htlc.State)
+	err = submit(stub, func() error { return contract.Claim(alice, hashLockOf("a"), "a") })
+	require.EqualError(t, err, "invalid claim: HTLC is CLAIMED")
+
+	// The HTLC with an escrow account stays locked and can be claimed
+	htlc, err = contract.GetHashTimeLock(bank, hashLockOf("b"))
+	require.NoError(t, err)
+	require.Equal(t, "LOCKED", htlc.State)
+	require.NoError(t, submit(stub, func() error { return contract.Claim(alice, hashLockOf("b"), "b") }))
+
+	aliceBalance, err := contract.BalanceOf(alice, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "50", aliceBalance.Available)
+	bankBalance, err := contract.BalanceOf(bank, bankID)
+	require.NoError(t, err)
+	require.Equal(t, "50", bankBalance.Available)
+	require.Equal(t, "0", bankBalance.Locked)
+}
+
+func TestMigrateSchema(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	alice := newContext(stub, aliceID, "Org2MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	version, err := contract.SchemaVersion(alice)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	// Records written before schema versioning, by a deployment that was never migrated
+	compositeKey := func(objectType string, key string) string {
+		compositeKey, err := stub.CreateCompositeKey(objectType, []string{key})
+		require.NoError(t, err)
+		return compositeKey
+	}
+	delete(stub.State, compositeKey("metadata", "schemaVersion"))
+	htlcKey := compositeKey("htlc", secretHashLock)
+	stub.State[htlcKey] = []byte(`{"sender":"` + bankID + `","recipient":"` + aliceID + `","amount":30,"hashLock":"` + secretHashLock + `","claimed":true}`)
+	feeScheduleKey := compositeKey("metadata", "feeSchedule")
+	stub.State[feeScheduleKey] = []byte(`{"type":"NONE","value":"0","treasury":"","exemptMSPs":[],"note":"kept"}`)
+	stub.State[compositeKey("proposal", "tx0")] = []byte(`{"id":"tx0","type":"MINT","proposer":"` + bankID + `","amount":"5","required":2,"approvals":[],"state":"CANCELLED"}`)
+	balanceKey := compositeKey("balance", aliceID)
+	stub.State[balanceKey] = []byte("7")
+	nameKey := compositeKey("metadata", "name")
+	stub.State[nameKey] = []byte("erc20")
+
+	// Bare values are read as they are until they are upgraded
+	balance, err := contract.BalanceOf(alice, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "7", balance.Available)
+
+	version, err = contract.SchemaVersion(alice)
+	require.NoError(t, err)
+	require.Equal(t, 0, version)
+
+	_, err = contract.GetMigrationPage(bank, 0, "")
+	require.EqualError(t, err, "page size must be between 1 and 500")
+	_, err = contract.GetMigrationPage(bank, 10, "zz")
+	require.EqualError(t, err, "invalid bookmark zz")
+	err = submit(stub, func() error { _, err := contract.Migrate(alice, []string{}, false); return err })
+	require.EqualError(t, err, "client is not authorized to migrate keys")
+	err = submit(stub, func() error { _, err := contract.Migrate(bank, []string{"zz"}, false); return err })
+	require.EqualError(t, err, "invalid key zz")
+
+	// The first page only reads the HTLC and the proposal
+	page, err := contract.GetMigrationPage(bank, 2, "")
+	require.NoError(t, err)
+	require.Equal(t, 2, page.Scanned)
+	require.Len(t, page.Keys, 2)
+	require.Equal(t, "proposal", page.ObjectType)
+	require.False(t, page.Done)
+	require.NotEmpty(t, page.Bookmark)
+
+	var progress *chaincode.MigrationProgress
+	err = submit(stub, func() error {
+		var err error
+		progress, err = contract.Migrate(bank, page.Keys, page.Done)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, progress.Upgraded)
+	require.False(t, progress.Done)
+	require.Equal(t, "MigrationProgress", stub.Event.Name)
+
+	var htlc map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.State[htlcKey], &htlc))
+	require.Equal(t, "30", htlc["amount"])
+	require.Equal(t, "CLAIMED", htlc["state"])
+	require.Equal(t, float64(2), htlc["schemaVersion"])
+	require.NotContains(t, htlc, "claimed")
+
+	// Later pages skip the records already at the current version, such as the history of the mint
+	upgraded := progress.Upgraded
+	for !page.Done {
+		page, err = contract.GetMigrationPage(bank, 2, page.Bookmark)
+		require.NoError(t, err)
+		require.LessOrEqual(t, page.Scanned, 2)
+		err = submit(stub, func() error {
+			var err error
+			progress, err = contract.Migrate(bank, page.Keys, page.Done)
+			return err
+		})
+		require.NoError(t, err)
+		upgraded += progress.Upgraded
+	}
+	require.Equal(t, 5, upgraded)
+	require.True(t, progress.Done)
+	require.Empty(t, page.Bookmark)
+
+	var schedule map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.State[feeScheduleKey], &schedule))
+	require.Equal(t, float64(2), schedule["schemaVersion"])
+	require.Equal(t, "kept", schedule["note"])
+	require.Equal(t, `{"value":"7","schemaVersion":2}`, string(stub.State[balanceKey]))
+	require.Equal(t, `{"value":"erc20","schemaVersion":2}`, string(stub.State[nameKey]))
+
+	name, err := contract.Name(alice)
+	require.NoError(t, err)
+	require.Equal(t, "erc20", name)
+	balance, err = contract.BalanceOf(alice, aliceID)
+	require.NoError(t, err)
+	require.Equal(t, "7", balance.Available)
+
+	version, err = contract.SchemaVersion(alice)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+
+	// Scanning again finds nothing to upgrade
+	page, err = contract.GetMigrationPage(bank, 500, "")
+	require.NoError(t, err)
+	require.Empty(t, page.Keys)
+	require.True(t, page.Done)
+}
+
+func TestAllowances(t *testing.T) {
+	stub := mocks.NewChaincodeStub()
+	bank := newAdminContext(stub, bankID, "Org1MSP")
+	bondx := newContext(stub, bondxID, "Org1MSP")
+	contract := chaincode.SmartContract{}
+
+	initializeBank(t, contract, bank)
+	require.NoError(t, submit(stub, func() error { return contract.Mint(bank, "100") }))
+
+	err := submit(stub, func() error { return contract.Approve(bank, bondxID, "-5") })
+	require.EqualError(t, err, "allowance cannot be negative")
+
+	err = submit(stub, func() error { return contract.TransferFrom(bondx, bankID, aliceID, "1") })
+	require.EqualError(t, err, "spender "+bondxID+" has no allowance from "+bankID)
+
+	require.NoError(t, submit(stub, func() error { return contract.Approve(bank, bondxID, "10") }))
+	require.NoError(t, submit(stub, func() error { return contract.IncreaseAllowance(bank, bondxID, "5") }))
+
+	allowance, err := contract.Allowance(bank, bankID, bondxID)
+	require.NoError(t, err)
+	require.Equal(t, "15", allowance)
+
+	require.Equal(t, "Approval", stub.Event.Name)
+	var approvalEvent map[string]interface{}
+	require.NoError(t, json.Unmarshal(stub.Event.Payload, &approvalEvent))
+	require.Equal(t, "15", approvalEvent["value"])
+
+	err = submit(stub, func() error { return contract.DecreaseAllowance(bank, bondxID, "16") })
+	require.EqualError(t, err, "decreased allowance below zero: current allowance of spender "+bondxID+" is 15")
+
+	require.NoError(t, submit(stub, func() error { return contract.DecreaseAllowance(bank, bondxID, "3") }))
+
+	// BondX spends part of the allowance before the owner's update is ordered
+	require.NoError(t, submit(stub, func() error { return contract.TransferFrom(bondx, bankID, aliceID, "4") }))
+
+	err = submit(stub, func() error { return contract.ApproveIfCurrent(bank, bondxID, "12", "20") })
+	require.EqualError(t, err, "allowance of spender "+bondxID+" is 8, expected 12")
+
+	require.NoError(t, submit(stub, func() error { return contract.ApproveIfCurrent(bank, bondxID, "8", "20") }))
+	require.NoError(t, submit(stub, func() error { return contract.Approve(bank, aliceID, "7") }))
+
+	allowances, err := contract.ListAllowances(bondx, bankID)
+	require.NoError(t, err)
+	require.Len(t, allowances, 2)
+	values := map[string]string{}
+	for _, entry := range allowances {
+		require.Equal(t, bankID, entry.Owner)
+		values[entry.Spender] = entry.Value
+	}
+	require.Equal(t, map[string]string{bondxID: "20", aliceID: "7"}, values)
+
+	// Approving 0 removes the allowance
+	require.NoError(t, submit(stub, func() error { return contract.Approve(bank, aliceID, "0") }))
+	allowances, err = contract.ListAllowances(bondx, bankID)
+	require.NoError(t, err)
+	require.Len(t, allowances, 1)
+}
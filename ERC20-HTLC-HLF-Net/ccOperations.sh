@@ -3,6 +3,14 @@ export CORE_PEER_TLS_ENABLED=true
 export TARGET_TLS_OPTIONS=(-o localhost:7050 --ordererTLSHostnameOverride orderer.example.com --tls --cafile "${PWD}/artifacts/channel/crypto-config/ordererOrganizations/example.com/orderers/orderer.example.com/msp/tlscacerts/tlsca.example.com-cert.pem" --peerAddresses localhost:7051 --tlsRootCertFiles "${PWD}/artifacts/channel/crypto-config/peerOrganizations/org1.example.com/peers/peer0.org1.example.com/tls/ca.crt" --peerAddresses localhost:9051 --tlsRootCertFiles "${PWD}/artifacts/channel/crypto-config/peerOrganizations/org2.example.com/peers/peer0.org2.example.com/tls/ca.crt")
 export CHANNEL_NAME=mychannel
 export CC_NAME="test-erc20-cc-1"
+export PREIMAGE="SECRET_PASSWORD"
+export HASH_LOCK=$(echo -n "${PREIMAGE}" | sha256sum | cut -d ' ' -f 1)
+export BATCH_PREIMAGE_1="BATCH_SECRET_1"
+export BATCH_HASH_LOCK_1=$(echo -n "${BATCH_PREIMAGE_1}" | sha256sum | cut -d ' ' -f 1)
+export BATCH_PREIMAGE_2="BATCH_SECRET_2"
+export BATCH_HASH_LOCK_2=$(echo -n "${BATCH_PREIMAGE_2}" | sha256sum | cut -d ' ' -f 1)
+export PRIVATE_PREIMAGE="PRIVATE_SECRET"
+export PRIVATE_HASH_LOCK=$(echo -n "${PRIVATE_PREIMAGE}" | sha256sum | cut -d ' ' -f 1)
 
 setGlobalsForOrg1() {
 
@@ -19,6 +27,31 @@ setGlobalsForOrg2() {
   export CORE_PEER_ADDRESS=localhost:9051
 }
 
+#Amounts are passed in the smallest token unit, with 0 decimals one unit is one token
+#Only an admin identity of Org1 can initialize the contract, it becomes the admin of the role registry
+contractInitialize() {
+  echo "token initialize"
+
+  setGlobalsForOrg1
+  export CORE_PEER_MSPCONFIGPATH=${PWD}/artifacts/channel/crypto-config/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp
+  peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
+    -c '{"function":"Initialize","Args":["erc20","BETH","0"]}'
+}
+
+#The Org1 admin that initialized the contract grants the operational roles to the bank identity
+grantRoles() {
+  echo "grant roles"
+
+  setGlobalsForOrg1
+  export BANK=$(peer chaincode query -C ${CHANNEL_NAME} -n ${CC_NAME} -c '{"function":"ClientAccountID","Args":[]}')
+  export CORE_PEER_MSPCONFIGPATH=${PWD}/artifacts/channel/crypto-config/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp
+  for ROLE in minter burner htlcOperator; do
+    peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
+      -c '{"function":"GrantRole","Args":["'"$ROLE"'", "'"$BANK"'"]}'
+    sleep 3
+  done
+}
+
 contractMint() {
   echo "token minting"
 
@@ -77,7 +110,7 @@ transferFromBondx() {
   echo "ALLOWANCE remaining-BONDX: $ALLOWANCE"
 }
 
-#Time stamp is in UTC
+#Time lock is either a UTC timestamp (RFC3339) or a duration counted from the transaction timestamp
 transferConditional() {
   echo "transfer Conditional"
   setGlobalsForOrg2
@@ -85,36 +118,85 @@ transferConditional() {
 
   setGlobalsForOrg1
   peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
-    -c '{"Args":["TransferConditional", "'"$ALICE"'", "2", "HASH_LOCK", "2024-01-22T12:01:00Z", "SECRET_PASSWORD"]}'
+    -c '{"Args":["TransferConditional", "'"$ALICE"'", "2", "'"$HASH_LOCK"'", "10m", "SHA256"]}'
 
 }
 
 getHashTimeLock() {
   echo "get HashTimeLock"
   setGlobalsForOrg1
-  peer chaincode query -C ${CHANNEL_NAME} -n ${CC_NAME} -c '{"Args":["GetHashTimeLock", "HASH_LOCK"]}'
+  peer chaincode query -C ${CHANNEL_NAME} -n ${CC_NAME} -c '{"Args":["GetHashTimeLock", "'"$HASH_LOCK"'"]}'
 
 }
 claim() {
   echo "get claim"
 
+  setGlobalsForOrg2
+  peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
+    -c '{"Args":["Claim", "'"$HASH_LOCK"'", "'"$PREIMAGE"'"]}'
+
+}
+
+#Batches take a JSON array and are applied atomically in a single transaction, the array is passed as an escaped JSON string argument
+transferConditionalBatch() {
+  echo "transfer Conditional batch"
+  setGlobalsForOrg2
+  export ALICE=$(peer chaincode query -C ${CHANNEL_NAME} -n ${CC_NAME} -c '{"function":"ClientAccountID","Args":[]}')
+
+  setGlobalsForOrg1
+  export BATCH='[{"recipient":"'"$ALICE"'","amount":"1","hashLock":"'"$BATCH_HASH_LOCK_1"'","timeLock":"10m"},{"recipient":"'"$ALICE"'","amount":"1","hashLock":"'"$BATCH_HASH_LOCK_2"'","timeLock":"10m"}]'
+  peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
+    -c '{"Args":["TransferConditionalBatch", "'"${BATCH//\"/\\\"}"'"]}'
+
+}
+
+#Batches are run by the htlcOperator, the claimed tokens still go to the recipient of each lock
+claimBatch() {
+  echo "claim batch"
+  setGlobalsForOrg1
+  export BATCH='[{"hashLock":"'"$BATCH_HASH_LOCK_1"'","preimage":"'"$BATCH_PREIMAGE_1"'"},{"hashLock":"'"$BATCH_HASH_LOCK_2"'","preimage":"'"$BATCH_PREIMAGE_2"'"}]'
+  peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
+    -c '{"Args":["ClaimBatch", "'"${BATCH//\"/\\\"}"'"]}'
+
+}
+
+#The recipient and amount are passed in the transient map and kept in the htlcTermsCollection private data collection
+transferConditionalPrivate() {
+  echo "transfer Conditional private"
+  setGlobalsForOrg2
+  export ALICE=$(peer chaincode query -C ${CHANNEL_NAME} -n ${CC_NAME} -c '{"function":"ClientAccountID","Args":[]}')
+
   setGlobalsForOrg1
+  export TERMS=$(echo -n '{"recipient":"'"$ALICE"'","amount":"1","salt":"'"$(openssl rand -hex 16)"'"}' | base64 | tr -d '\n')
   peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
-    -c '{"Args":["Claim", "HASH_LOCK", "SECRET_PASSWORD"]}'
+    -c '{"Args":["TransferConditionalPrivate", "'"$PRIVATE_HASH_LOCK"'", "10m", "SHA256"]}' \
+    --transient '{"htlcTerms":"'"$TERMS"'"}'
+
+}
+
+claimPrivate() {
+  echo "claim private"
+  setGlobalsForOrg2
+  peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
+    -c '{"Args":["Claim", "'"$PRIVATE_HASH_LOCK"'", "'"$PRIVATE_PREIMAGE"'"]}'
 
 }
 
 revert() {
   echo "revert"
   setGlobalsForOrg1
-  export CORE_PEER_MSPCONFIGPATH=${PWD}/artifacts/channel/crypto-config/peerOrganizations/org1.example.com/users/bondx@org1.example.com/msp
-  export BONDX=$(peer chaincode query -C ${CHANNEL_NAME} -n ${CC_NAME} -c '{"function":"ClientAccountID","Args":[]}')
-  setGlobalsForOrg1
   peer chaincode invoke "${TARGET_TLS_OPTIONS[@]}" -C ${CHANNEL_NAME} -n ${CC_NAME} \
-    -c '{"Args":["Revert", "HASH_LOCK"]}'
+    -c '{"Args":["Revert", "'"$HASH_LOCK"'"]}'
 
 }
 
+#Setting the token name, symbol and decimals
+contractInitialize
+sleep 3
+
+#Granting the minter, burner and htlcOperator roles to bank entity
+grantRoles
+
 #Minting tokens
 contractMint
 sleep 3
@@ -150,9 +232,25 @@ sleep 1
 clientAccountBalanceOrg2
 sleep 2
 
-#Raise the claim to transfer the tokens from bank entity to Alice
+#Alice raises the claim with the preimage to receive the tokens locked by bank entity
 claim
 sleep 2
 
-#Revert the transfer by sending tokens from Alice to bank entity 
+#Lock tokens for Alice under two hash locks in a single transaction
+transferConditionalBatch
+sleep 3
+
+#Bank settles both locks for Alice in a single transaction
+claimBatch
+sleep 2
+
+#Lock tokens for Alice keeping the recipient and amount off the public ledger
+transferConditionalPrivate
+sleep 3
+
+#Alice claims the private lock like a public one
+claimPrivate
+sleep 2
+
+#Revert the transfer by returning the escrowed tokens to bank entity, only possible once the time lock has expired and the lock was not claimed
 revert
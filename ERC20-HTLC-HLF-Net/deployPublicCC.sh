@@ -39,6 +39,7 @@ VERSION="1"
 SEQUENCE="1"
 CC_SRC_PATH="./artifacts/src/github.com/test-erc-20"
 CC_NAME="test-erc20-cc-1"
+CC_COLLECTIONS_CONFIG="${CC_SRC_PATH}/collections_config.json"
 
 packageSetup() {
     echo Vendoring Go dependencies ...
@@ -83,7 +84,7 @@ approveForMyOrg1() {
         --ordererTLSHostnameOverride orderer.example.com --tls \
         --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name ${CC_NAME} --version ${VERSION} \
         --package-id ${PACKAGE_ID} \
-        --sequence ${SEQUENCE}
+        --sequence ${SEQUENCE} --collections-config ${CC_COLLECTIONS_CONFIG}
 
     echo "===================== chaincode approved from org 1 ===================== "
 
@@ -93,7 +94,7 @@ checkCommitReadiness1() {
     setGlobalsForPeer0Org1
 
     peer lifecycle chaincode checkcommitreadiness --channelID $CHANNEL_NAME --name ${CC_NAME} --version ${VERSION} \
-        --sequence ${SEQUENCE} --output json
+        --sequence ${SEQUENCE} --collections-config ${CC_COLLECTIONS_CONFIG} --output json
 
     echo "===================== checking commit readyness from org 1 ===================== "
 }
@@ -105,7 +106,7 @@ approveForMyOrg2() {
         --ordererTLSHostnameOverride orderer.example.com --tls $CORE_PEER_TLS_ENABLED \
         --cafile $ORDERER_CA --channelID $CHANNEL_NAME --name ${CC_NAME} \
         --version ${VERSION} --package-id ${PACKAGE_ID} \
-        --sequence ${SEQUENCE}
+        --sequence ${SEQUENCE} --collections-config ${CC_COLLECTIONS_CONFIG}
 
     echo "===================== chaincode approved from org 2 ===================== "
 }
@@ -114,7 +115,7 @@ checkCommitReadiness2() {
 
     setGlobalsForPeer0Org2
     peer lifecycle chaincode checkcommitreadiness --channelID $CHANNEL_NAME --name ${CC_NAME} --version ${VERSION} \
-        --sequence ${SEQUENCE} --output json
+        --sequence ${SEQUENCE} --collections-config ${CC_COLLECTIONS_CONFIG} --output json
     echo "===================== checking commit readyness from org 2 ===================== "
 }
 
@@ -125,7 +126,7 @@ commitChaincodeDefination() {
         --channelID $CHANNEL_NAME --name ${CC_NAME} \
         --peerAddresses localhost:7051 --tlsRootCertFiles $PEER0_ORG1_CA \
         --peerAddresses localhost:9051 --tlsRootCertFiles $PEER0_ORG2_CA \
-        --version ${VERSION} --sequence ${SEQUENCE}
+        --version ${VERSION} --sequence ${SEQUENCE} --collections-config ${CC_COLLECTIONS_CONFIG}
 
 }
 